@@ -3,6 +3,7 @@ package cdiscount
 import (
 	"context"
 	"errors"
+	"fmt"
 	"strconv"
 	"strings"
 	"time"
@@ -10,8 +11,12 @@ import (
 	"github.com/chromedp/chromedp"
 	"golang.org/x/net/html"
 
+	"github.com/lack-io/cirrus/config"
+	"github.com/lack-io/cirrus/internal/cluster"
+	"github.com/lack-io/cirrus/internal/daemon"
 	"github.com/lack-io/cirrus/internal/log"
 	"github.com/lack-io/cirrus/internal/parser"
+	"github.com/lack-io/cirrus/internal/urlx"
 	"github.com/lack-io/cirrus/proxy"
 	"github.com/lack-io/cirrus/storage"
 	"github.com/lack-io/cirrus/store"
@@ -19,6 +24,9 @@ import (
 
 const (
 	prefix = "https://www.cdiscount.com"
+
+	// taskTimeout 爬取一个页面的超时时间
+	taskTimeout = time.Minute * 2
 )
 
 type Kind string
@@ -29,6 +37,88 @@ const (
 	Link    Kind = "link"
 )
 
+// defaultPriority 未配置 storage.priority 时使用的优先级策略，优先爬取宝贝页面
+var defaultPriority = map[string]int{
+	string(Group): 0,
+	string(Link):  10,
+}
+
+// defaultCanonical 未配置 storage.canonical 时使用的 url 规范化参数
+var defaultCanonical = urlx.Options{
+	Scheme: "https",
+	Hosts: map[string]string{
+		"cdiscount.com":   "www.cdiscount.com",
+		"m.cdiscount.com": "www.cdiscount.com",
+	},
+	Params: []string{"utm_*", "gclid", "fbclid", "cm_*"},
+}
+
+func canonicalOptions(cfg *config.StorageCanonical) urlx.Options {
+	if cfg == nil {
+		return defaultCanonical
+	}
+	return urlx.Options{Scheme: cfg.Scheme, Hosts: cfg.Hosts, Params: cfg.Params}
+}
+
+// resolve 将页面 base 中的链接 href 解析为规范化的绝对路径，并返回 url 的类型
+func (c *Cdiscount) resolve(base, href string) (string, Kind) {
+	v, err := c.canon.Resolve(base, href)
+	if err != nil {
+		return href, Unknown
+	}
+	return urlParser(v)
+}
+
+// newURL 根据 url 的类型和优先级策略生成 storage.URL，url 的类型同时决定重新爬取的时间间隔，
+// parent 为发现 url 的页面，起始路径的 parent 为 nil
+func (c *Cdiscount) newURL(s storage.Storage, parent *storage.URL, path string, kind Kind) storage.URL {
+	policy := c.cfg.Storage.Priority
+	if policy == nil {
+		policy = defaultPriority
+	}
+	url := storage.URL{
+		Path:       path,
+		Priority:   policy[string(kind)],
+		Kind:       string(kind),
+		Discovered: time.Now().Unix(),
+		Storage:    s,
+	}
+	if parent != nil {
+		url.Depth = parent.Depth + 1
+		url.Parent = parent.Path
+	}
+	return url
+}
+
+// push 保存页面 parent 中发现的 url，超过当前任务最大深度的 url 不会被保存
+func (c *Cdiscount) push(parent *storage.URL, path string, kind Kind) {
+	url := c.newURL(parent.Storage, parent, path, kind)
+
+	c.spaceLock.RLock()
+	maxDepth := c.task.MaxDepth
+	c.spaceLock.RUnlock()
+	if maxDepth > 0 && url.Depth > maxDepth {
+		return
+	}
+
+	log.Infof("===> 保存请求路径 %v", path)
+	_ = parent.Storage.Push(url)
+}
+
+// current 返回当前任务命名空间中的 storage
+func (c *Cdiscount) current() storage.Storage {
+	c.spaceLock.RLock()
+	defer c.spaceLock.RUnlock()
+	return c.space
+}
+
+// paused 返回当前任务是否已经暂停
+func (c *Cdiscount) paused() bool {
+	c.spaceLock.RLock()
+	defer c.spaceLock.RUnlock()
+	return c.task.Paused
+}
+
 func (c *Cdiscount) daemon() {
 	timer := time.NewTicker(time.Millisecond * 500)
 	for {
@@ -36,13 +126,14 @@ func (c *Cdiscount) daemon() {
 		case <-c.ctx.Done():
 			return
 		case <-timer.C:
-			if int(c.threads.Load()) < c.cfg.Client.Connections {
-				u, _ := c.storage.Get()
+			if !c.draining.Load() && !c.paused() && int(c.threads.Load()) < c.cfg.Client.Connections {
+				u, _ := c.current().Get()
 				if u != nil {
 					log.Infof("<=== 获取请求路径 %v", u.Path)
 					c.threads.Add(1)
 					c.goPool.NewTask(func() {
-						c.do(u.Path)
+						defer c.threads.Sub(1)
+						c.do(u)
 					})
 				}
 			}
@@ -50,46 +141,161 @@ func (c *Cdiscount) daemon() {
 	}
 }
 
+// drain 停止获取新的 url，并等待正在爬取的 url 完成
+func (c *Cdiscount) drain() {
+	c.draining.Store(true)
+
+	timer := time.NewTicker(time.Millisecond * 100)
+	defer timer.Stop()
+	deadline := time.After(taskTimeout)
+	for c.threads.Load() > 0 {
+		select {
+		case <-deadline:
+			log.Errorf("等待 %d 个正在爬取的 url 超时", c.threads.Load())
+			return
+		case <-timer.C:
+		}
+	}
+}
+
 // StartDaemon implemented daemon.Daemon interfaces
-func (c *Cdiscount) StartDaemon(root string) {
-	c.storage.Reset()
-	_ = c.storage.Push(storage.URL{Path: root})
+func (c *Cdiscount) StartDaemon(opts daemon.Options) error {
+	root, kind := c.resolve(opts.Root, opts.Root)
+	if kind == Unknown {
+		log.Errorf("目录路径 %s 无效", root)
+		return fmt.Errorf("目录路径 %s 无效", root)
+	}
+	if err := storage.CheckNamespace(opts.Namespace); err != nil {
+		return err
+	}
+	// 集群中只有协调者可以启动任务
+	if c.cluster != nil && !c.cluster.IsCoordinator() {
+		return cluster.ErrNotCoordinator
+	}
+
+	maxDepth := opts.MaxDepth
+	if maxDepth == 0 {
+		maxDepth = c.cfg.Storage.MaxDepth
+	}
+
+	task := cluster.Task{Namespace: opts.Namespace, Root: root, MaxDepth: maxDepth}
+	if c.cluster != nil {
+		// 集群中的实例 (包括当前实例) 通过 Follow 切换到新的任务。SetTask 在 redis 中确认当前实例仍然是协调者，
+		// 需要在清空命名空间之前调用，避免失去协调者身份时清空正在运行的任务
+		if err := c.cluster.SetTask(task); err != nil {
+			return err
+		}
+	}
+
+	s := c.storage.Namespace(opts.Namespace)
+	s.Reset()
+	if err := s.Push(c.newURL(s, nil, root, kind)); err != nil {
+		log.Errorf("保存起始 url %s 失败: %v", root, err)
+		return err
+	}
+	if c.cluster == nil {
+		c.Follow(task)
+	}
+	log.Infof("在命名空间 %s 中开始抓取 %s", opts.Namespace, root)
+	return nil
 }
 
 // PauseDaemon implemented daemon.Daemon interfaces
-func (c *Cdiscount) PauseDaemon() {
-	c.storage.Reset()
+func (c *Cdiscount) PauseDaemon() error {
+	if err := c.setPaused(true); err != nil {
+		return err
+	}
+	log.Infof("暂停抓取")
+	return nil
+}
+
+// ResumeDaemon implemented daemon.Daemon interfaces
+func (c *Cdiscount) ResumeDaemon() error {
+	if err := c.setPaused(false); err != nil {
+		return err
+	}
+	log.Infof("继续抓取")
+	return nil
 }
 
-// do 请求 url
-func (c *Cdiscount) do(url string) {
-	url, kind := urlParser(url)
+// setPaused 暂停或者继续当前的任务，正在爬取的 url 会继续完成，storage 中的 url 不受影响
+func (c *Cdiscount) setPaused(paused bool) error {
+	if c.cluster != nil && !c.cluster.IsCoordinator() {
+		return cluster.ErrNotCoordinator
+	}
+
+	c.spaceLock.RLock()
+	task := c.task
+	c.spaceLock.RUnlock()
+
+	task.Paused = paused
+	if c.cluster != nil {
+		// 集群中的实例通过 Follow 暂停或者继续任务
+		return c.cluster.SetTask(task)
+	}
+	c.Follow(task)
+	return nil
+}
+
+// ClearDaemon implemented daemon.Daemon interfaces
+func (c *Cdiscount) ClearDaemon(namespace string) error {
+	if c.cluster != nil && !c.cluster.IsCoordinator() {
+		return cluster.ErrNotCoordinator
+	}
+
+	s := c.current()
+	if namespace != "" {
+		if err := storage.CheckNamespace(namespace); err != nil {
+			return err
+		}
+		s = c.storage.Namespace(namespace)
+	}
+	s.Reset()
+	return nil
+}
+
+// Report implemented cluster.Member interfaces
+func (c *Cdiscount) Report() (concurrency, running int) {
+	return c.cfg.Client.Connections, int(c.threads.Load())
+}
+
+// Follow implemented cluster.Member interfaces
+func (c *Cdiscount) Follow(task cluster.Task) {
+	c.spaceLock.Lock()
+	c.space = c.storage.Namespace(task.Namespace)
+	c.task = task
+	c.spaceLock.Unlock()
+}
+
+// do 请求 url，请求成功时确认 url，失败时将 url 放回 storage
+func (c *Cdiscount) do(u *storage.URL) {
+	url, kind := urlParser(u.Path)
 	if kind == Unknown {
 		log.Infof("目录路径 %s 无效", url)
+		_ = u.Storage.Persist(*u)
 		return
 	}
-	c.runTask(url, kind)
+
+	err := c.runTask(u, url, kind)
+	if err != nil {
+		log.Errorf("请求 %s 失败: %v", url, err)
+		if u.Storage.Nack(*u, err) == storage.ErrDeadURL {
+			log.Errorf("请求 %s 超过最大爬取次数，放入死信队列", url)
+		}
+		return
+	}
+	log.Infof("请求 %s 成功 !!!", url)
+	_ = u.Storage.Persist(*u)
 }
 
-func (c *Cdiscount) runTask(url string, kind Kind) {
-	ctx, cancel := context.WithTimeout(c.ctx, time.Minute*2)
+// runTask 请求并解析页面，页面中的链接保存到 u 所在的命名空间中
+func (c *Cdiscount) runTask(u *storage.URL, url string, kind Kind) (err error) {
+	ctx, cancel := context.WithTimeout(c.ctx, taskTimeout)
 	defer cancel()
 
-	var err error
-	defer func() {
-		c.threads.Sub(1)
-		if err != nil {
-			log.Errorf("请求 %s 失败: %v", url, err)
-			return
-		}
-		log.Infof("请求 %s 成功 !!!", url)
-		_ = c.storage.Persist(storage.URL{Path: url})
-	}()
-
 	var endpoint *proxy.Endpoint
 	endpoint, err = c.ProxyPool.GetEndpoint(ctx)
 	if err != nil {
-		_ = c.storage.Push(storage.URL{Path: url, Storage: c.storage})
 		return
 	}
 	log.Infof("获取代理节点 %v", endpoint.Addr())
@@ -105,7 +311,6 @@ func (c *Cdiscount) runTask(url string, kind Kind) {
 		Actions(actions...).
 		Do(ctx, url)
 	if err != nil {
-		_ = c.storage.Push(storage.URL{Path: url, Storage: c.storage})
 		return
 	}
 
@@ -135,10 +340,9 @@ func (c *Cdiscount) runTask(url string, kind Kind) {
 		for _, node := range q.Each("body", "a") {
 			for _, attr := range node.Attr {
 				if attr.Key == "href" {
-					v, kind := urlParser(attr.Val)
+					v, kind := c.resolve(url, attr.Val)
 					if kind != Unknown {
-						log.Infof("===> 保存请求路径 %v", v)
-						_ = c.storage.Push(storage.URL{Path: v, Storage: c.storage})
+						c.push(u, v, kind)
 					}
 					continue
 				}
@@ -148,10 +352,9 @@ func (c *Cdiscount) runTask(url string, kind Kind) {
 		for _, node := range q.Each("body", "a") {
 			for _, attr := range node.Attr {
 				if attr.Key == "href" {
-					v, kind := urlParser(attr.Val)
+					v, kind := c.resolve(url, attr.Val)
 					if kind != Unknown {
-						log.Infof("===> 保存请求路径 %v", v)
-						_ = c.storage.Push(storage.URL{Path: v, Storage: c.storage})
+						c.push(u, v, kind)
 					}
 					continue
 				}
@@ -176,38 +379,59 @@ func (c *Cdiscount) runTask(url string, kind Kind) {
 		}
 
 		sout, _ := q.Html(".pSOutOfStock .fpSOTitleName")
-		if len(sout) != 0 {
-			good := store.Good{
-				URL:       url,
-				UID:       urlToID(url),
-				Comments:  0,
-				Brandless: express == "AUCUNE",
-				Express:   express,
-				ScaleOut:  true,
-				Timestamp: time.Now().Unix(),
-			}
-			log.Infof("保存符合要求的宝贝: %v", good.UID)
-			err := c.store.AddGood(&good)
-			if err != nil {
-				log.Errorf("保存宝贝 %s 失败: %v", good.UID, err)
-			}
-			log.Infof("页面 %s 解析结束!", url)
-			return
-		}
+		info := parseProduct(q)
 
 		// 获取评论信息
 		commentTag := strings.TrimSpace(q.Text(".fpTMain .fpDesCol .fpCusto"))
 		commentSt := strings.SplitN(commentTag, " ", 2)
 		comments, _ := strconv.ParseInt(strings.TrimSpace(commentSt[0]), 10, 64)
-		if !(comments > 0) {
-			return
-		}
 
 		// 获取发货渠道信息
 		expressDocs := []string{}
 		q.For("#fpShipping .fpShippingMessage", "li .fpShippingText", func(s string, node *html.Node) {
 			expressDocs = append(expressDocs, s)
 		})
+
+		// 记录每次爬取到的宝贝状态，不论宝贝是否符合要求
+		c.observe(&store.Observation{
+			UID:       urlToID(url),
+			Comments:  int(comments),
+			ScaleOut:  len(sout) != 0,
+			Shipping:  strings.Join(expressDocs, "; "),
+			Price:     info.Price,
+			Timestamp: time.Now().Unix(),
+		})
+
+		if len(sout) != 0 {
+			good := store.Good{
+				URL:        url,
+				UID:        urlToID(url),
+				Comments:   0,
+				Brandless:  express == "AUCUNE",
+				Express:    express,
+				ScaleOut:   true,
+				Timestamp:  time.Now().Unix(),
+				Depth:      u.Depth,
+				Parent:     u.Parent,
+				Provenance: storage.Provenance(u.Storage, *u),
+				Title:      info.Title,
+				Price:      info.Price,
+				Currency:   info.Currency,
+				Seller:     info.Seller,
+				Category:   info.Category,
+				Rating:     info.Rating,
+				Image:      info.Image,
+				EAN:        info.EAN,
+			}
+			c.save(&good)
+			log.Infof("页面 %s 解析结束!", url)
+			return
+		}
+
+		if !(comments > 0) {
+			return
+		}
+
 		if len(expressDocs) != 2 {
 			return
 		}
@@ -217,20 +441,48 @@ func (c *Cdiscount) runTask(url string, kind Kind) {
 
 		// 保存符合的宝贝
 		good := store.Good{
-			URL:       url,
-			UID:       urlToID(url),
-			Comments:  int(comments),
-			Brandless: express == "AUCUNE",
-			Express:   express,
-			Timestamp: time.Now().Unix(),
-		}
-		log.Infof("保存符合要求的宝贝: %v", good.UID)
-		err := c.store.AddGood(&good)
-		if err != nil {
-			log.Errorf("保存宝贝 %s 失败: %v", good.UID, err)
+			URL:        url,
+			UID:        urlToID(url),
+			Comments:   int(comments),
+			Brandless:  express == "AUCUNE",
+			Express:    express,
+			Timestamp:  time.Now().Unix(),
+			Depth:      u.Depth,
+			Parent:     u.Parent,
+			Provenance: storage.Provenance(u.Storage, *u),
+			Title:      info.Title,
+			Price:      info.Price,
+			Currency:   info.Currency,
+			Seller:     info.Seller,
+			Category:   info.Category,
+			Rating:     info.Rating,
+			Image:      info.Image,
+			EAN:        info.EAN,
 		}
+		c.save(&good)
 	}
 	log.Infof("页面 %s 解析结束!", url)
+	return
+}
+
+// save 保存符合要求的宝贝，已经被删除的宝贝不会再次保存
+func (c *Cdiscount) save(good *store.Good) {
+	log.Infof("保存符合要求的宝贝: %v", good.UID)
+	err := c.store.AddGood(good)
+	if errors.Is(err, store.ErrDeleted) {
+		log.Infof("宝贝 %s 已经被删除，不再保存", good.UID)
+		return
+	}
+	if err != nil {
+		log.Errorf("保存宝贝 %s 失败: %v", good.UID, err)
+	}
+}
+
+// observe 保存一次爬取到的宝贝状态
+func (c *Cdiscount) observe(o *store.Observation) {
+	if err := c.store.AddObservation(o); err != nil {
+		log.Errorf("保存宝贝 %s 的状态失败: %v", o.UID, err)
+	}
 }
 
 // urlToID 从宝贝的路径提取id
@@ -248,7 +500,7 @@ func urlToID(url string) string {
 
 // urlParser 返回处理过的 url 和 url 的类型
 func urlParser(url string) (string, Kind) {
-	if url == prefix || url == prefix + "/" {
+	if url == prefix || url == prefix+"/" {
 		return url, Group
 	}
 
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"net/http"
 	"path/filepath"
+	"sync"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -13,11 +14,16 @@ import (
 	"github.com/lack-io/cirrus/config"
 	"github.com/lack-io/cirrus/controller"
 	"github.com/lack-io/cirrus/internal/client"
+	"github.com/lack-io/cirrus/internal/cluster"
 	"github.com/lack-io/cirrus/internal/log"
 	"github.com/lack-io/cirrus/internal/net"
 	"github.com/lack-io/cirrus/internal/pool"
+	"github.com/lack-io/cirrus/internal/urlx"
 	"github.com/lack-io/cirrus/storage"
+	"github.com/lack-io/cirrus/storage/file"
+	"github.com/lack-io/cirrus/storage/memory"
 	"github.com/lack-io/cirrus/storage/redis"
+	"github.com/lack-io/cirrus/storage/stream"
 	"github.com/lack-io/cirrus/store"
 )
 
@@ -27,7 +33,7 @@ type Cdiscount struct {
 
 	cfg *config.Config
 
-	store *store.Store
+	store store.Store
 
 	ProxyPool *Pool
 
@@ -37,23 +43,43 @@ type Cdiscount struct {
 
 	storage storage.Storage
 
+	// space 当前任务命名空间中的 storage
+	space storage.Storage
+
+	// task 当前的任务，task.MaxDepth 为 0 时不限制深度，task.Paused 为 true 时不再获取新的 url
+	task cluster.Task
+
+	// spaceLock space 和 task 的读写锁
+	spaceLock sync.RWMutex
+
+	// cluster 集群，未启用集群时为 nil
+	cluster *cluster.Cluster
+
+	// canon url 规范化，所有的 url 在保存到 storage 前都需要规范化
+	canon *urlx.Canonicalizer
+
 	goPool *pool.Pool
 
 	threads *atomic.Int32
+
 	startCh chan struct{}
 	pauseCh chan struct{}
+
+	// draining 为 true 时不再获取新的 url
+	draining *atomic.Bool
 }
 
 func NewCdiscount(cfg *config.Config) (*Cdiscount, error) {
 	ctx, cancel := context.WithCancel(context.Background())
 	cds := &Cdiscount{
-		ctx:     ctx,
-		cancel:  cancel,
-		cfg:     cfg,
-		goPool:  pool.New(ctx, cfg.Client.Connections),
-		threads: atomic.NewInt32(0),
-		startCh: make(chan struct{}, 1),
-		pauseCh: make(chan struct{}, 1),
+		ctx:      ctx,
+		cancel:   cancel,
+		cfg:      cfg,
+		goPool:   pool.New(ctx, cfg.Client.Connections),
+		threads:  atomic.NewInt32(0),
+		draining: atomic.NewBool(false),
+		startCh:  make(chan struct{}, 1),
+		pauseCh:  make(chan struct{}, 1),
 	}
 
 	if err := cds.initLogger(); err != nil {
@@ -72,6 +98,12 @@ func NewCdiscount(cfg *config.Config) (*Cdiscount, error) {
 	}
 	log.Info("init storage [ok]")
 
+	log.Info("init cluster")
+	if err := cds.initCluster(); err != nil {
+		return nil, err
+	}
+	log.Info("init cluster [ok]")
+
 	log.Info("init proxy pool")
 	if err := cds.initPool(); err != nil {
 		return nil, err
@@ -103,21 +135,60 @@ func (c *Cdiscount) initStore() error {
 	if err != nil {
 		return err
 	}
+	if db, ok := s.(*store.DB); ok && db.FTS4() {
+		log.Warn("sqlite 不支持 FTS5，全文搜索降级为 FTS4，按照命中次数排序，编译时需要添加 -tags sqlite_fts5")
+	}
 	c.store = s
 	return nil
 }
 
-func (c *Cdiscount) initStorage() error {
-	var err error
-	switch c.cfg.Storage.Kind {
+// NewStorage 根据配置创建并初始化 storage
+func NewStorage(ctx context.Context, cfg *config.Storage) (storage.Storage, error) {
+	var s storage.Storage
+	opts := storage.NewOptions(cfg)
+	switch cfg.Kind {
 	case config.Redis:
-		c.storage = redis.NewRedis(c.ctx, c.cfg.Storage.Redis)
-		err = c.storage.Init()
-		if err != nil {
-			return err
-		}
+		s = redis.NewRedis(ctx, cfg.Redis, opts)
+	case config.Memory:
+		s = memory.NewMemory(ctx, opts)
+	case config.File:
+		s = file.NewFile(ctx, cfg.File, opts)
+	case config.Stream:
+		s = stream.NewStream(ctx, cfg.Redis, opts)
+	default:
+		return nil, fmt.Errorf("未知的 storage 类型: %v", cfg.Kind)
+	}
+
+	err := s.Init()
+	if err != nil {
+		return nil, err
 	}
+	return s, nil
+}
 
+func (c *Cdiscount) initStorage() error {
+	s, err := NewStorage(c.ctx, c.cfg.Storage)
+	if err != nil {
+		return err
+	}
+	c.storage = s
+	c.space = c.storage.Namespace(storage.DefaultNamespace)
+	c.task = cluster.Task{Namespace: storage.DefaultNamespace, MaxDepth: c.cfg.Storage.MaxDepth}
+
+	c.canon = urlx.New(canonicalOptions(c.cfg.Storage.Canonical))
+	return nil
+}
+
+func (c *Cdiscount) initCluster() error {
+	if c.cfg.Cluster == nil || !c.cfg.Cluster.Enable {
+		return nil
+	}
+	// 集群中的实例需要共享同一个 storage
+	if c.cfg.Storage.Kind != config.Redis && c.cfg.Storage.Kind != config.Stream {
+		return fmt.Errorf("集群模式不支持 storage 类型: %v", c.cfg.Storage.Kind)
+	}
+
+	c.cluster = cluster.New(c.ctx, c.cfg.Storage.Redis, cluster.NewOptions(c.cfg.Cluster))
 	return nil
 }
 
@@ -163,7 +234,11 @@ func (c *Cdiscount) initServe() {
 	api.Use(controller.CORS())
 	controller.RegistryTaskController(c, api)
 	controller.RegistryGoodController(c.store, api)
+	controller.RegistryStorageController(c.storage, api)
 	controller.RegistryProxyController(c.ProxyPool.pp, api)
+	if c.cluster != nil {
+		controller.RegistryClusterController(c.cluster, api)
+	}
 
 	c.Serve = &http.Server{
 		Addr:         fmt.Sprintf("%s:%d", c.cfg.Web.Binding, c.cfg.Web.Port),
@@ -177,6 +252,13 @@ func (c *Cdiscount) Start(stop <-chan struct{}) {
 
 	go c.Serve.ListenAndServe()
 	log.Infof("start at %v", c.Serve.Addr)
+	if c.cluster != nil {
+		if err := c.cluster.Join(c); err != nil {
+			log.Errorf("加入集群失败: %v", err)
+		} else {
+			log.Infof("加入集群 %s", c.cluster.ID())
+		}
+	}
 	go c.daemon()
 	log.Infof("start daemon")
 
@@ -188,6 +270,13 @@ func (c *Cdiscount) Start(stop <-chan struct{}) {
 }
 
 func (c *Cdiscount) Close() error {
+	if c.cluster != nil {
+		// 等待正在爬取的 url 完成后再离开集群，避免其他实例等待租约超时
+		c.drain()
+		if err := c.cluster.Leave(); err != nil {
+			log.Errorf("离开集群失败: %v", err)
+		}
+	}
 	c.cancel()
 	c.ProxyPool.Close()
 	return log.Sync()
@@ -0,0 +1,156 @@
+package cdiscount
+
+import (
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/html"
+
+	"github.com/lack-io/cirrus/internal/parser"
+)
+
+// product 宝贝页面中的商品信息
+type product struct {
+	Title    string
+	Price    float64
+	Currency string
+	Seller   string
+	Category string
+	Rating   float64
+	Image    string
+	EAN      string
+}
+
+// parseProduct 解析宝贝页面中的商品信息，优先使用 schema.org 的标记，其次使用 cdiscount 页面的样式，
+// 页面中不存在的信息为空
+func parseProduct(q *parser.Parser) product {
+	p := product{
+		Title: first(q, `h1[itemprop="name"]`, ".fpDesCol h1", `meta[property="og:title"]@content`),
+		Price: parsePrice(q),
+		Seller: first(q, `[itemprop="seller"] [itemprop="name"]@content`, `[itemprop="seller"] [itemprop="name"]`,
+			".fpSellerName", ".fpSellBy a"),
+		Image: first(q, `[itemprop="image"]@content`, `img[itemprop="image"]@src`, `meta[property="og:image"]@content`,
+			"#picture0@src"),
+		EAN:      first(q, `[itemprop="gtin13"]@content`, `[itemprop="gtin13"]`, `[itemprop="gtin"]@content`),
+		Category: parseCategory(q),
+	}
+
+	p.Currency = first(q, `[itemprop="priceCurrency"]@content`, `meta[property="product:price:currency"]@content`)
+	if p.Currency == "" && p.Price > 0 {
+		// cdiscount 只使用欧元
+		p.Currency = "EUR"
+	}
+
+	rating := first(q, `[itemprop="ratingValue"]@content`, `[itemprop="ratingValue"]`)
+	// 评分可能是 4,5 或者 4.5/5 的格式
+	rating = strings.TrimSpace(strings.SplitN(rating, "/", 2)[0])
+	p.Rating, _ = strconv.ParseFloat(strings.Replace(rating, ",", ".", 1), 64)
+
+	if p.EAN == "" {
+		// 商品参数表格中的 EAN
+		p.EAN = spec(q, "EAN", "Code EAN", "GTIN")
+	}
+	return p
+}
+
+// first 依次查找 selectors 中的元素，返回第一个非空的文本内容，selector 为 sel@attr 时返回元素的属性
+func first(q *parser.Parser, selectors ...string) string {
+	for _, sel := range selectors {
+		var v string
+		if i := strings.LastIndex(sel, "@"); i != -1 {
+			v, _ = q.Attr(sel[:i], sel[i+1:])
+		} else {
+			v = q.First(sel)
+		}
+		if v = strings.TrimSpace(v); v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// parseCategory 返回面包屑导航中的分类，不包括首页，以 > 分隔
+func parseCategory(q *parser.Parser) string {
+	for _, sel := range []string{`[itemtype*="BreadcrumbList"]`, "#bc", ".breadcrumb"} {
+		var names []string
+		q.For(sel, "li", func(text string, node *html.Node) {
+			text = strings.Join(strings.Fields(text), " ")
+			if text != "" && text != "Accueil" {
+				names = append(names, text)
+			}
+		})
+		if len(names) > 0 {
+			return strings.Join(names, " > ")
+		}
+	}
+	return ""
+}
+
+// spec 返回商品参数表格中第一个名称为 names 之一的参数的值
+func spec(q *parser.Parser, names ...string) string {
+	var docs []string
+	q.For("#fpContent #descContent table", "tbody tr td", func(text string, node *html.Node) {
+		docs = append(docs, strings.TrimSpace(text))
+	})
+	for i := 0; i < len(docs)-1; i++ {
+		for _, name := range names {
+			if docs[i] == name {
+				return docs[i+1]
+			}
+		}
+	}
+	return ""
+}
+
+// parsePrice 返回宝贝页面中的价格，优先使用 itemprop="price" 的 content 属性，
+// 其次解析 .fpPrice 中的文本，页面中没有价格时返回 0
+func parsePrice(q *parser.Parser) float64 {
+	if v, ok := q.Attr(`[itemprop="price"]`, "content"); ok {
+		if price, err := strconv.ParseFloat(strings.TrimSpace(v), 64); err == nil {
+			return price
+		}
+	}
+	if v, ok := q.Attr(".fpPrice", "content"); ok {
+		if price, err := strconv.ParseFloat(strings.TrimSpace(v), 64); err == nil {
+			return price
+		}
+	}
+	return priceFromText(q.First(".fpPrice"))
+}
+
+// priceFromText 解析 19€99、1 299,00 €、1.299,00€ 和 1.299 € 格式的价格。
+// 两个数字之间的 € 为小数点；否则最后一个 . 或者 , 为小数点，
+// 但是只出现一次的分隔符之后刚好是三位数字，或者同一个分隔符出现多次时为千位分隔符
+func priceFromText(text string) float64 {
+	text = strings.Map(func(r rune) rune {
+		switch {
+		case r >= '0' && r <= '9', r == '€', r == ',', r == '.':
+			return r
+		}
+		return -1
+	}, strings.TrimSpace(text))
+	text = strings.Trim(text, "€,.")
+
+	digits := func(s string) string {
+		return strings.Map(func(r rune) rune {
+			if r >= '0' && r <= '9' {
+				return r
+			}
+			return -1
+		}, s)
+	}
+	if idx := strings.Index(text, "€"); idx != -1 {
+		text = digits(text[:idx]) + "." + digits(text[idx+len("€"):])
+	} else if idx := strings.LastIndexAny(text, ",."); idx != -1 {
+		sep := text[idx : idx+1]
+		thousands := strings.Count(text, sep) > 1 ||
+			(len(text)-idx-1 == 3 && !strings.ContainsAny(text[:idx], ",."))
+		if thousands {
+			text = digits(text)
+		} else {
+			text = digits(text[:idx]) + "." + text[idx+1:]
+		}
+	}
+	price, _ := strconv.ParseFloat(text, 64)
+	return price
+}
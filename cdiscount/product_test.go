@@ -0,0 +1,85 @@
+package cdiscount
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/lack-io/cirrus/internal/parser"
+)
+
+func TestPriceFromText(t *testing.T) {
+	tests := map[string]float64{
+		"19€99":       19.99,
+		"19€":         19,
+		"1 299,00 €":  1299,
+		"1.299,00€":   1299,
+		"  249,90 € ": 249.9,
+		"1.299 €":     1299,
+		"1,299€":      1299,
+		"1.299.000 €": 1299000,
+		"12€99":       12.99,
+		"1.024€50":    1024.5,
+		"12,5 €":      12.5,
+		"1 299 €":     1299,
+		"":            0,
+		"Épuisé":      0,
+	}
+	for text, price := range tests {
+		assert.Equal(t, price, priceFromText(text), text)
+	}
+}
+
+func TestParsePrice(t *testing.T) {
+	q, err := parser.NewParser(`<div><span class="fpPrice price" itemprop="price" content="24.99">24€99</span></div>`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, 24.99, parsePrice(q))
+
+	q, err = parser.NewParser(`<div><span class="fpPrice price">1 024€50</span></div>`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, 1024.5, parsePrice(q))
+}
+
+func TestParseProduct(t *testing.T) {
+	q, err := parser.NewParser(`<html><head>
+<meta property="og:image" content="https://i2.cdscdn.com/pdt2/a/b/c/1/700x700/abc.jpg">
+</head><body>
+<ul id="bc"><li><a>Accueil</a></li><li><a>Informatique</a></li><li><a>Souris</a></li></ul>
+<div class="fpTMain"><div class="fpDesCol">
+	<h1 itemprop="name"> Souris sans fil Logitech M185 </h1>
+	<span class="fpPrice price" itemprop="price" content="14.99">14€99</span>
+	<meta itemprop="priceCurrency" content="EUR">
+	<span itemprop="ratingValue">4,5/5</span>
+	<p class="fpSellBy">Vendu et expédié par <a class="fpSellerName">Cdiscount</a></p>
+</div></div>
+<div id="fpContent"><div id="descContent"><table><tbody>
+	<tr><td>Marque</td><td>LOGITECH</td></tr>
+	<tr><td>EAN</td><td>5099206027282</td></tr>
+</tbody></table></div></div>
+</body></html>`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, product{
+		Title:    "Souris sans fil Logitech M185",
+		Price:    14.99,
+		Currency: "EUR",
+		Seller:   "Cdiscount",
+		Category: "Informatique > Souris",
+		Rating:   4.5,
+		Image:    "https://i2.cdscdn.com/pdt2/a/b/c/1/700x700/abc.jpg",
+		EAN:      "5099206027282",
+	}, parseProduct(q))
+
+	// 页面中不存在的信息为空
+	q, err = parser.NewParser(`<div><span class="fpPrice">9€</span></div>`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, product{Price: 9, Currency: "EUR"}, parseProduct(q))
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"flag"
+	"os"
 
 	"github.com/lack-io/cirrus/cdiscount"
 	"github.com/lack-io/cirrus/config"
@@ -10,6 +11,20 @@ import (
 )
 
 func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "export", "import":
+			snapshot(os.Args[1], os.Args[2:])
+			return
+		case "export-goods":
+			exportGoods(os.Args[2:])
+			return
+		case "migrate":
+			migrate(os.Args[2:])
+			return
+		}
+	}
+
 	cfg := flag.String("config", "config", "cirrus.toml")
 	flag.Parse()
 
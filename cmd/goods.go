@@ -0,0 +1,102 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/lack-io/cirrus/config"
+	"github.com/lack-io/cirrus/internal/signal"
+	"github.com/lack-io/cirrus/store"
+)
+
+// exportGoods 将满足查询条件的宝贝导出到目录中，查询条件与 GET /api/v1/goods/export 的查询参数相同，
+// every 大于 0 时每隔 every 导出一次，用于定时导出
+//
+//	cirrus export-goods -config cirrus.toml -format xlsx -dir exports -filter "latest=true&minPrice=10"
+//	cirrus export-goods -config cirrus.toml -format csv -dir exports -q clavier -every 24h
+func exportGoods(args []string) {
+	set := flag.NewFlagSet("export-goods", flag.ExitOnError)
+	cfg := set.String("config", "cirrus.toml", "配置文件路径")
+	name := set.String("format", string(store.CSV), "导出的文件格式，csv、xlsx 或者 jsonl")
+	dir := set.String("dir", ".", "导出文件所在的目录")
+	q := set.String("q", "", "全文搜索的关键词")
+	query := set.String("filter", "", "查询条件，例如 latest=true&minPrice=10&sort=price:asc")
+	every := set.Duration("every", 0, "定时导出的间隔，为 0 时只导出一次")
+	_ = set.Parse(args)
+
+	format, err := store.ParseFormat(*name)
+	if err != nil {
+		fatalf("%v", err)
+	}
+	values, err := url.ParseQuery(*query)
+	if err != nil {
+		fatalf("解析查询条件失败: %v", err)
+	}
+	filter, err := store.ParseFilter(values)
+	if err != nil {
+		fatalf("%v", err)
+	}
+
+	if err = config.Init(*cfg); err != nil {
+		fatalf("读取配置文件失败: %v", err)
+	}
+	s, err := store.NewStore(config.Get().Store)
+	if err != nil {
+		fatalf("初始化 store 失败: %v", err)
+	}
+	if db, ok := s.(*store.DB); ok && db.FTS4() && *q != "" {
+		fmt.Fprintln(os.Stderr, "sqlite 不支持 FTS5，全文搜索降级为 FTS4，按照命中次数排序，编译时需要添加 -tags sqlite_fts5")
+	}
+	if err = os.MkdirAll(*dir, 0755); err != nil {
+		fatalf("创建导出目录失败: %v", err)
+	}
+
+	stop := signal.SetupSignalHandler()
+	for {
+		path, n, err := exportFile(s, *dir, format, *q, filter)
+		if err != nil && *every <= 0 {
+			fatalf("导出宝贝失败 (已导出 %d 个宝贝): %v", n, err)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "导出宝贝失败 (已导出 %d 个宝贝): %v\n", n, err)
+		} else {
+			fmt.Fprintf(os.Stderr, "导出宝贝完成，共 %d 个宝贝: %s\n", n, path)
+		}
+
+		if *every <= 0 {
+			return
+		}
+		select {
+		case <-stop:
+			return
+		case <-time.After(*every):
+		}
+	}
+}
+
+// exportFile 将宝贝导出到 dir 中以导出时间命名的文件，导出完成前写入临时文件，避免读取到不完整的文件
+func exportFile(s store.Store, dir string, format store.Format, q string, filter *store.Filter) (string, int, error) {
+	tmp, err := ioutil.TempFile(dir, ".goods-*.tmp")
+	if err != nil {
+		return "", 0, err
+	}
+	defer os.Remove(tmp.Name())
+	// 临时文件默认只有当前用户可以读取
+	_ = tmp.Chmod(0644)
+
+	n, err := store.Export(s, tmp, format, q, filter)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return "", n, err
+	}
+
+	path := filepath.Join(dir, fmt.Sprintf("goods-%s.%s", time.Now().Format("20060102-150405"), format))
+	return path, n, os.Rename(tmp.Name(), path)
+}
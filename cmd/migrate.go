@@ -0,0 +1,82 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/lack-io/cirrus/config"
+	"github.com/lack-io/cirrus/store"
+)
+
+// migrate 查看、升级或者回滚数据库的表结构，默认查看迁移的执行状态。
+// up 默认升级到最新的版本，down 默认回滚一个版本，-to 指定升级或者回滚到的版本
+//
+//	cirrus migrate -config cirrus.toml status
+//	cirrus migrate -config cirrus.toml up
+//	cirrus migrate -config cirrus.toml -to 5 down
+func migrate(args []string) {
+	set := flag.NewFlagSet("migrate", flag.ExitOnError)
+	cfg := set.String("config", "cirrus.toml", "配置文件路径")
+	to := set.Int("to", -1, "升级或者回滚到的版本，up 默认为最新的版本，down 默认为上一个版本")
+	_ = set.Parse(args)
+
+	action := "status"
+	if set.NArg() > 0 {
+		action = set.Arg(0)
+	}
+
+	if err := config.Init(*cfg); err != nil {
+		fatalf("读取配置文件失败: %v", err)
+	}
+	m, err := store.NewMigrator(config.Get().Store)
+	if err != nil {
+		fatalf("连接数据库失败: %v", err)
+	}
+	defer m.Close()
+
+	switch action {
+	case "status":
+	case "up":
+		if *to < 0 {
+			*to = 0
+		}
+		err = m.Up(*to)
+	case "down":
+		if *to < 0 {
+			var version int
+			if version, err = m.Version(); err == nil && version > 0 {
+				*to = version - 1
+			}
+		}
+		if err == nil && *to >= 0 {
+			err = m.Down(*to)
+		}
+	default:
+		fatalf("未知的操作 %q，可选 status、up 或者 down", action)
+	}
+	if err != nil {
+		fatalf("迁移数据库失败: %v", err)
+	}
+
+	status, err := m.Status()
+	if err != nil {
+		fatalf("读取迁移状态失败: %v", err)
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "VERSION\tNAME\tAPPLIED AT")
+	for _, s := range status {
+		applied := "-"
+		if s.Applied {
+			applied = time.Unix(s.AppliedAt, 0).Format("2006-01-02 15:04:05")
+		}
+		name := s.Name
+		if s.Unknown {
+			name += " (unknown)"
+		}
+		fmt.Fprintf(w, "%d\t%s\t%s\n", s.Version, name, applied)
+	}
+	_ = w.Flush()
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/lack-io/cirrus/cdiscount"
+	"github.com/lack-io/cirrus/config"
+	"github.com/lack-io/cirrus/storage"
+)
+
+// snapshot 导出或者导入 storage 的快照
+//
+//	cirrus export -config cirrus.toml -namespace default -file frontier.jsonl
+//	cirrus import -config cirrus.toml -namespace default -file frontier.jsonl
+func snapshot(action string, args []string) {
+	set := flag.NewFlagSet(action, flag.ExitOnError)
+	cfg := set.String("config", "cirrus.toml", "配置文件路径")
+	ns := set.String("namespace", storage.DefaultNamespace, "命名空间")
+	name := set.String("file", "-", "快照文件路径，- 表示标准输入或者标准输出")
+	_ = set.Parse(args)
+
+	if err := storage.CheckNamespace(*ns); err != nil {
+		fatalf("%v", err)
+	}
+	if err := config.Init(*cfg); err != nil {
+		fatalf("读取配置文件失败: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	s, err := cdiscount.NewStorage(ctx, config.Get().Storage)
+	if err != nil {
+		fatalf("初始化 storage 失败: %v", err)
+	}
+	s = s.Namespace(*ns)
+
+	var n int
+	switch action {
+	case "export":
+		var w io.WriteCloser = os.Stdout
+		if *name != "-" {
+			if w, err = os.Create(*name); err != nil {
+				fatalf("创建快照文件失败: %v", err)
+			}
+		}
+		n, err = storage.Export(s, w)
+		if cerr := w.Close(); err == nil {
+			err = cerr
+		}
+	case "import":
+		var r io.ReadCloser = os.Stdin
+		if *name != "-" {
+			if r, err = os.Open(*name); err != nil {
+				fatalf("打开快照文件失败: %v", err)
+			}
+		}
+		n, err = storage.Import(s, r)
+		_ = r.Close()
+	}
+	if err != nil {
+		fatalf("%s 快照失败 (已处理 %d 条记录): %v", action, n, err)
+	}
+	fmt.Fprintf(os.Stderr, "%s 快照完成，共 %d 条记录\n", action, n)
+}
+
+func fatalf(format string, v ...interface{}) {
+	fmt.Fprintf(os.Stderr, format+"\n", v...)
+	os.Exit(1)
+}
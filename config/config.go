@@ -14,7 +14,10 @@ var (
 type Kind string
 
 const (
-	Redis Kind = "redis"
+	Redis  Kind = "redis"
+	Memory Kind = "memory"
+	File   Kind = "file"
+	Stream Kind = "stream"
 )
 
 // Get 获取全局 config
@@ -37,6 +40,8 @@ type Config struct {
 
 	Storage *Storage `toml:"storage"`
 
+	Cluster *Cluster `toml:"cluster"`
+
 	Store *Store `toml:"store"`
 
 	Client *Client `toml:"Client"`
@@ -62,8 +67,65 @@ type Storage struct {
 	// URL 存储方式
 	Kind Kind `toml:"kind"`
 
-	// Redis 配置，Storage=Redis 时有效
+	// URL 优先级策略，key 为 url 的类型，value 为优先级，数值越大越先被爬取
+	Priority map[string]int `toml:"priority"`
+
+	// URL 租约时间(单位为秒)，超时未确认的 URL 会被重新放回队列
+	Lease int `toml:"lease"`
+
+	// URL 最大的爬取次数，超过后 URL 进入死信队列
+	MaxAttempts int `toml:"max_attempts"`
+
+	// 从任务的起始路径开始爬取的最大深度，0 表示不限制，可以被任务的参数覆盖
+	MaxDepth int `toml:"max_depth"`
+
+	// URL 重新爬取的时间间隔(单位为秒)，key 为 url 的类型，未配置或者为 0 的类型不会重新爬取
+	Recrawl map[string]int `toml:"recrawl"`
+
+	// URL 规范化配置
+	Canonical *StorageCanonical `toml:"canonical"`
+
+	// 爬取过的 URL 的记录方式，默认为 Hash
+	Visited Visited `toml:"visited"`
+
+	// 布隆过滤器配置，Visited=Bloom 时有效
+	Bloom *StorageBloom `toml:"bloom"`
+
+	// Redis 配置，Storage=Redis 或者 Storage=Stream 时有效
 	Redis *StorageRedis `toml:"redis"`
+
+	// File 配置，Storage=File 时有效
+	File *StorageFile `toml:"file"`
+}
+
+type Visited string
+
+const (
+	// Hash 记录所有爬取过的 URL
+	Hash Visited = "hash"
+	// Bloom 使用布隆过滤器记录爬取过的 URL
+	Bloom Visited = "bloom"
+)
+
+// Storage 模块布隆过滤器配置
+type StorageBloom struct {
+	// 预计的 URL 个数
+	Capacity uint64 `toml:"capacity"`
+
+	// 误判率
+	FPRate float64 `toml:"fp_rate"`
+}
+
+// Storage 模块 url 规范化配置
+type StorageCanonical struct {
+	// 统一使用的协议
+	Scheme string `toml:"scheme"`
+
+	// 域名别名，key 为别名，value 为规范的域名
+	Hosts map[string]string `toml:"hosts"`
+
+	// 需要去除的查询参数，以 * 结尾时按照前缀匹配
+	Params []string `toml:"params"`
 }
 
 // Storage 模块 redis 配置
@@ -79,24 +141,57 @@ type StorageRedis struct {
 
 	// Redis 连接数
 	Pools int `toml:"pools"`
+
+	// Stream 消费者的名称，Storage=Stream 时有效，默认为 主机名-进程号
+	Consumer string `toml:"consumer"`
+}
+
+// Storage 模块 file 配置
+type StorageFile struct {
+	// sqlite 文件路径
+	Name string `toml:"name"`
+}
+
+// Cluster 模块配置
+type Cluster struct {
+	// 是否启用集群，启用后多个实例共享 storage.redis 中的 url
+	Enable bool `toml:"enable"`
+
+	// 实例的 ID，默认为 主机名-进程号
+	ID string `toml:"id"`
+
+	// 心跳间隔(单位为秒)
+	Heartbeat int `toml:"heartbeat"`
+
+	// 心跳超时时间(单位为秒)，超时的实例会被移出集群
+	Timeout int `toml:"timeout"`
 }
 
 type StoreDB string
 
 const (
-	Sqlite StoreDB = "sqlite"
+	Sqlite   StoreDB = "sqlite"
+	Postgres StoreDB = "postgres"
 )
 
 type Store struct {
 	DB StoreDB `toml:"db"`
 
 	Sqlite *DBSqlite `toml:"sqlite"`
+
+	// Postgres 配置，DB=Postgres 时有效
+	Postgres *DBPostgres `toml:"postgres"`
 }
 
 type DBSqlite struct {
 	Name string `toml:"name"`
 }
 
+type DBPostgres struct {
+	// 连接字符串，例如 host=127.0.0.1 port=5432 user=cirrus password=cirrus dbname=cirrus sslmode=disable
+	DSN string `toml:"dsn"`
+}
+
 // Client 模块配置
 type Client struct {
 	// Headless 是否隐藏 chrome
@@ -0,0 +1,51 @@
+package controller
+
+import (
+	"errors"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/lack-io/cirrus/internal/cluster"
+)
+
+func RegistryClusterController(c *cluster.Cluster, handler *gin.RouterGroup) {
+	controller := clusterController{c: c}
+	group := handler.Group("/v1/cluster")
+	{
+		group.GET("/workers", controller.getWorkers())
+	}
+}
+
+type clusterController struct {
+	c *cluster.Cluster
+}
+
+// getWorkers 返回集群中所有的实例、协调者和当前的任务
+func (c *clusterController) getWorkers() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		workers, err := c.c.Workers()
+		if err != nil {
+			R().Ctx(ctx).Fail(err)
+			return
+		}
+		coordinator, err := c.c.Coordinator()
+		if err != nil {
+			R().Ctx(ctx).Fail(err)
+			return
+		}
+		task, err := c.c.Task()
+		if err != nil && !errors.Is(err, cluster.ErrNoTask) {
+			R().Ctx(ctx).Fail(err)
+			return
+		}
+
+		R().Ctx(ctx).OK(gin.H{
+			"id":          c.c.ID(),
+			"coordinator": coordinator,
+			"task":        task,
+			"list":        workers,
+			"total":       len(workers),
+		})
+		return
+	}
+}
@@ -1,40 +1,66 @@
 package controller
 
 import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 
 	"github.com/lack-io/cirrus/store"
 )
 
-func RegistryGoodController(store *store.Store, handler *gin.RouterGroup) {
+func RegistryGoodController(store store.Store, handler *gin.RouterGroup) {
 	controller := goodController{store: store}
 	group := handler.Group("/v1/goods")
 	{
-		group.GET("", controller.getGoods())
+		group.GET("", controller.getGoods(false))
+		group.GET("/trash", controller.getGoods(true))
+		group.GET("/export", controller.exportGoods())
+		group.GET("/:uid/provenance", controller.getProvenance())
+		group.GET("/:uid/history", controller.getHistory())
+		group.PATCH("/:id", controller.patchGood())
+		group.POST("/action/state", controller.setState())
+		group.POST("/action/delete", controller.deleteGoods())
+		group.POST("/action/restore", controller.restoreGoods())
 		group.DELETE("/:id", controller.delGood())
 	}
 }
 
 type goodController struct {
-	store *store.Store
+	store store.Store
 }
 
-func (c *goodController) getGoods() gin.HandlerFunc {
+// getGoods 返回满足查询参数的宝贝，q 不为空时按照相关度返回全文搜索的结果，查询参数见 store.ParseFilter，
+// trash 为 true 时返回回收站中的宝贝
+func (c *goodController) getGoods(trash bool) gin.HandlerFunc {
 	return func(ctx *gin.Context) {
 		page := DefaultQueryInt64(ctx, "page", 1)
 		size := DefaultQueryInt64(ctx, "size", 10)
-		start := DefaultQueryInt64(ctx, "start", 0)
-		end := DefaultQueryInt64(ctx, "end", 0)
 
-		var err error
-		var goods []*store.Good
+		filter, err := store.ParseFilter(ctx.Request.URL.Query())
+		if err != nil {
+			R().Ctx(ctx).Bad(err)
+			return
+		}
+		filter.Deleted = trash
+
+		q := strings.TrimSpace(ctx.Query("q"))
+
+		var goods interface{}
 		pagination := &store.Pagination{Page: int(page), Size: int(size)}
-		if start > 0 || end > 0 {
-			goods, err = c.store.GetGoodsByTimeout(start, end, pagination)
+		if q != "" {
+			goods, err = c.store.SearchGoods(q, filter, pagination)
 		} else {
-			goods, err = c.store.GetGoods(pagination)
+			goods, err = c.store.GetGoods(filter, pagination)
+		}
+		if errors.Is(err, store.ErrInvalidQuery) {
+			R().Ctx(ctx).Bad(err)
+			return
 		}
 		if err != nil {
 			R().Ctx(ctx).Fail(err)
@@ -49,12 +75,114 @@ func (c *goodController) getGoods() gin.HandlerFunc {
 	}
 }
 
+// exportGoods 以 format (csv、xlsx 或者 jsonl，默认为 csv) 格式下载满足查询参数的所有宝贝，查询参数与 getGoods 相同
+func (c *goodController) exportGoods() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		format, err := store.ParseFormat(ctx.DefaultQuery("format", string(store.CSV)))
+		if err != nil {
+			R().Ctx(ctx).Bad(err)
+			return
+		}
+		filter, err := store.ParseFilter(ctx.Request.URL.Query())
+		if err != nil {
+			R().Ctx(ctx).Bad(err)
+			return
+		}
+		q := strings.TrimSpace(ctx.Query("q"))
+
+		name := fmt.Sprintf("goods-%s.%s", time.Now().Format("20060102-150405"), format)
+		ctx.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%s", name))
+		ctx.Header("Content-Type", format.ContentType())
+		ctx.Status(http.StatusOK)
+		// 响应已经开始写入，导出失败时只能中断响应
+		if _, err := store.Export(c.store, ctx.Writer, format, q, filter); err != nil {
+			_ = ctx.Error(err)
+			ctx.Abort()
+		}
+		return
+	}
+}
+
+// patchGood 修改宝贝的审核状态、备注和标签，请求体中没有的字段不修改
+func (c *goodController) patchGood() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		id, err := strconv.ParseInt(ctx.Param("id"), 10, 64)
+		if err != nil {
+			R().Ctx(ctx).Bad(fmt.Errorf("%w: invalid id %q", store.ErrInvalidQuery, ctx.Param("id")))
+			return
+		}
+		patch := &store.Patch{}
+		if err = ctx.ShouldBindJSON(patch); err != nil {
+			R().Ctx(ctx).Bad(fmt.Errorf("%w: %v", store.ErrInvalidQuery, err))
+			return
+		}
+
+		good, err := c.store.UpdateGood(id, patch)
+		if errors.Is(err, store.ErrInvalidQuery) || errors.Is(err, store.ErrNotFound) {
+			R().Ctx(ctx).Bad(err)
+			return
+		}
+		if err != nil {
+			R().Ctx(ctx).Fail(err)
+			return
+		}
+
+		R().Ctx(ctx).OK(good)
+		return
+	}
+}
+
+// setState 批量修改宝贝的审核状态，修改请求体中 ids 对应的宝贝，
+// 或者满足查询参数 (与 getGoods 相同) 的宝贝，两者同时存在时需要同时满足
+func (c *goodController) setState() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		type data struct {
+			IDs      []int64     `json:"ids,omitempty"`
+			State    store.State `json:"state,omitempty"`
+			Reviewer string      `json:"reviewer,omitempty"`
+		}
+
+		d := data{}
+		if err := ctx.ShouldBindJSON(&d); err != nil {
+			R().Ctx(ctx).Bad(fmt.Errorf("%w: %v", store.ErrInvalidQuery, err))
+			return
+		}
+		if d.State == "" {
+			R().Ctx(ctx).Bad(fmt.Errorf("缺少 state 参数"))
+			return
+		}
+		filter, err := store.ParseFilter(ctx.Request.URL.Query())
+		if err != nil {
+			R().Ctx(ctx).Bad(err)
+			return
+		}
+		filter.IDs = append(filter.IDs, d.IDs...)
+
+		n, err := c.store.SetGoodsState(filter, d.State, d.Reviewer)
+		if errors.Is(err, store.ErrInvalidQuery) {
+			R().Ctx(ctx).Bad(err)
+			return
+		}
+		if err != nil {
+			R().Ctx(ctx).Fail(err)
+			return
+		}
+
+		R().Ctx(ctx).OK(gin.H{"total": n})
+		return
+	}
+}
+
 func (c *goodController) delGood() gin.HandlerFunc {
 	return func(ctx *gin.Context) {
 		ids := ctx.Param("id")
 		id, _ := strconv.ParseInt(ids, 10, 64)
 
 		good, err := c.store.DelGroup(id)
+		if errors.Is(err, store.ErrNotFound) {
+			R().Ctx(ctx).Bad(err)
+			return
+		}
 		if err != nil {
 			R().Ctx(ctx).Fail(err)
 			return
@@ -64,3 +192,129 @@ func (c *goodController) delGood() gin.HandlerFunc {
 		return
 	}
 }
+
+// deleteGoods 批量删除宝贝，删除请求体中 ids 对应的宝贝，或者满足查询参数 (与 getGoods 相同) 的宝贝，
+// 删除的宝贝放入回收站，爬虫不会再次保存
+func (c *goodController) deleteGoods() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		filter, err := bulkFilter(ctx)
+		if err != nil {
+			R().Ctx(ctx).Bad(err)
+			return
+		}
+
+		n, err := c.store.DeleteGoods(filter)
+		if errors.Is(err, store.ErrInvalidQuery) {
+			R().Ctx(ctx).Bad(err)
+			return
+		}
+		if err != nil {
+			R().Ctx(ctx).Fail(err)
+			return
+		}
+
+		R().Ctx(ctx).OK(gin.H{"total": n})
+		return
+	}
+}
+
+// restoreGoods 恢复回收站中的宝贝，参数与 deleteGoods 相同
+func (c *goodController) restoreGoods() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		filter, err := bulkFilter(ctx)
+		if err != nil {
+			R().Ctx(ctx).Bad(err)
+			return
+		}
+
+		n, err := c.store.RestoreGoods(filter)
+		if errors.Is(err, store.ErrInvalidQuery) {
+			R().Ctx(ctx).Bad(err)
+			return
+		}
+		if err != nil {
+			R().Ctx(ctx).Fail(err)
+			return
+		}
+
+		R().Ctx(ctx).OK(gin.H{"total": n})
+		return
+	}
+}
+
+// bulkFilter 解析批量操作的条件，请求体中的 ids 与查询参数需要同时满足
+func bulkFilter(ctx *gin.Context) (*store.Filter, error) {
+	type data struct {
+		IDs []int64 `json:"ids,omitempty"`
+	}
+
+	// 请求体可以为空，无效的请求体不能被忽略，否则会操作所有满足查询参数的宝贝
+	d := data{}
+	if err := ctx.ShouldBindJSON(&d); err != nil && err != io.EOF {
+		return nil, fmt.Errorf("%w: %v", store.ErrInvalidQuery, err)
+	}
+	filter, err := store.ParseFilter(ctx.Request.URL.Query())
+	if err != nil {
+		return nil, err
+	}
+	filter.IDs = append(filter.IDs, d.IDs...)
+	return filter, nil
+}
+
+// getProvenance 返回宝贝页面的来源，provenance 为从任务的起始路径到宝贝页面的路径链
+func (c *goodController) getProvenance() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		good, err := c.store.GetGoodByUID(ctx.Param("uid"))
+		if errors.Is(err, store.ErrNotFound) {
+			R().Ctx(ctx).Bad(err)
+			return
+		}
+		if err != nil {
+			R().Ctx(ctx).Fail(err)
+			return
+		}
+
+		chain := append(store.Chain{}, good.Provenance...)
+		chain = append(chain, good.URL)
+		R().Ctx(ctx).OK(gin.H{
+			"uid":        good.UID,
+			"url":        good.URL,
+			"depth":      good.Depth,
+			"parent":     good.Parent,
+			"provenance": chain,
+		})
+		return
+	}
+}
+
+// getHistory 按照爬取时间顺序返回宝贝的评论数、库存、发货渠道和价格的变化，
+// start 和 end 限制爬取时间的范围，宝贝不存在时无论是否指定时间范围都返回 Bad
+func (c *goodController) getHistory() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		uid := ctx.Param("uid")
+		start := DefaultQueryInt64(ctx, "start", 0)
+		end := DefaultQueryInt64(ctx, "end", 0)
+
+		_, err := c.store.GetGoodByUID(uid)
+		if errors.Is(err, store.ErrNotFound) {
+			R().Ctx(ctx).Bad(err)
+			return
+		}
+		if err != nil {
+			R().Ctx(ctx).Fail(err)
+			return
+		}
+
+		list, err := c.store.GetObservations(uid, start, end)
+		if err != nil {
+			R().Ctx(ctx).Fail(err)
+			return
+		}
+
+		R().Ctx(ctx).OK(gin.H{
+			"uid":  uid,
+			"list": list,
+		})
+		return
+	}
+}
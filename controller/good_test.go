@@ -0,0 +1,292 @@
+package controller
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/lack-io/cirrus/config"
+	"github.com/lack-io/cirrus/store"
+)
+
+// response R() 返回的响应
+type response struct {
+	Code int `json:"code"`
+
+	Data json.RawMessage `json:"data"`
+}
+
+// goods getGoods 返回的 data
+type goods struct {
+	List []*store.Good `json:"list"`
+
+	Pagination *store.Pagination `json:"pagination"`
+}
+
+// newGoodServer 返回使用 sqlite 存储宝贝的 gin 服务，注册所有宝贝相关的路由，
+// 宝贝 a 有两次爬取记录
+func newGoodServer(t *testing.T) (*gin.Engine, store.Store) {
+	s, err := store.NewSqlite(&config.DBSqlite{Name: filepath.Join(t.TempDir(), "cirrus.db")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, good := range []*store.Good{
+		{
+			UID: "a", URL: "https://www.cdiscount.com/f-a.html", Title: "Clavier mécanique", Price: 49.9,
+			Comments: 10, Timestamp: 100, Parent: "https://www.cdiscount.com/l-1.html",
+			Provenance: store.Chain{"https://www.cdiscount.com", "https://www.cdiscount.com/l-1.html"},
+		},
+		{UID: "b", URL: "https://www.cdiscount.com/f-b.html", Title: "Souris sans fil", Price: 19.9, Comments: 3, Timestamp: 200},
+	} {
+		if err = s.AddGood(good); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, o := range []*store.Observation{
+		{UID: "a", Comments: 8, Price: 59.9, Timestamp: 100},
+		{UID: "a", Comments: 10, Price: 49.9, Timestamp: 200},
+	} {
+		if err = s.AddObservation(o); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	gin.SetMode(gin.TestMode)
+	handler := gin.New()
+	RegistryGoodController(s, handler.Group("/api"))
+	return handler, s
+}
+
+// serve 发送请求并解析响应，响应的状态码总是 200，错误由 code 区分
+func serve(t *testing.T, handler http.Handler, method, target, body string) *response {
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(method, target, strings.NewReader(body)))
+	if !assert.Equal(t, http.StatusOK, w.Code, target) {
+		return &response{Code: -1}
+	}
+	r := &response{}
+	if err := json.Unmarshal(w.Body.Bytes(), r); err != nil {
+		t.Fatalf("%s: %v", target, err)
+	}
+	return r
+}
+
+// idOf 返回 UID 为 uid 的宝贝的 ID
+func idOf(t *testing.T, s store.Store, uid string) uint64 {
+	good, err := s.GetGoodByUID(uid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return good.ID
+}
+
+// uids 返回宝贝列表中的 UID
+func uids(t *testing.T, r *response) []string {
+	data := &goods{}
+	if err := json.Unmarshal(r.Data, data); err != nil {
+		t.Fatal(err)
+	}
+	list := make([]string, 0, len(data.List))
+	for _, good := range data.List {
+		list = append(list, good.UID)
+	}
+	return list
+}
+
+func TestGoodController_GetGoods(t *testing.T) {
+	handler, _ := newGoodServer(t)
+
+	r := serve(t, handler, http.MethodGet, "/api/v1/goods", "")
+	if assert.Equal(t, 0, r.Code) {
+		assert.Equal(t, []string{"b", "a"}, uids(t, r))
+	}
+
+	r = serve(t, handler, http.MethodGet, "/api/v1/goods?q=clavier", "")
+	if assert.Equal(t, 0, r.Code) {
+		assert.Equal(t, []string{"a"}, uids(t, r))
+	}
+
+	r = serve(t, handler, http.MethodGet, "/api/v1/goods?sort=price:desc", "")
+	if assert.Equal(t, 0, r.Code) {
+		assert.Equal(t, []string{"a", "b"}, uids(t, r))
+	}
+
+	r = serve(t, handler, http.MethodGet, "/api/v1/goods?minPrice=20", "")
+	if assert.Equal(t, 0, r.Code) {
+		assert.Equal(t, []string{"a"}, uids(t, r))
+	}
+}
+
+func TestGoodController_GetGoodsBad(t *testing.T) {
+	handler, _ := newGoodServer(t)
+
+	for _, target := range []string{
+		"/api/v1/goods?minPrice=cheap",
+		"/api/v1/goods?minPrice=50&maxPrice=10",
+		"/api/v1/goods?state=unknown",
+		"/api/v1/goods?sort=color",
+		"/api/v1/goods?sort=price:up",
+		"/api/v1/goods?q=clavier&sort=color",
+		"/api/v1/goods/trash?sort=color",
+	} {
+		assert.Equal(t, 3, serve(t, handler, http.MethodGet, target, "").Code, target)
+	}
+}
+
+func TestGoodController_Export(t *testing.T) {
+	handler, _ := newGoodServer(t)
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/goods/export?format=xlsx", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, store.XLSX.ContentType(), w.Header().Get("Content-Type"))
+	assert.Contains(t, w.Header().Get("Content-Disposition"), ".xlsx")
+	assert.True(t, strings.HasPrefix(w.Body.String(), "PK"))
+
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/goods/export?q=souris", nil))
+	assert.Equal(t, store.CSV.ContentType(), w.Header().Get("Content-Type"))
+	assert.Contains(t, w.Body.String(), "Souris sans fil")
+	assert.NotContains(t, w.Body.String(), "Clavier")
+
+	assert.Equal(t, 3, serve(t, handler, http.MethodGet, "/api/v1/goods/export?format=pdf", "").Code)
+	assert.Equal(t, 3, serve(t, handler, http.MethodGet, "/api/v1/goods/export?sort=color", "").Code)
+}
+
+func TestGoodController_Provenance(t *testing.T) {
+	handler, _ := newGoodServer(t)
+
+	r := serve(t, handler, http.MethodGet, "/api/v1/goods/a/provenance", "")
+	if assert.Equal(t, 0, r.Code) {
+		data := struct {
+			Parent     string      `json:"parent"`
+			Provenance store.Chain `json:"provenance"`
+		}{}
+		assert.NoError(t, json.Unmarshal(r.Data, &data))
+		assert.Equal(t, "https://www.cdiscount.com/l-1.html", data.Parent)
+		assert.Equal(t, store.Chain{
+			"https://www.cdiscount.com",
+			"https://www.cdiscount.com/l-1.html",
+			"https://www.cdiscount.com/f-a.html",
+		}, data.Provenance)
+	}
+
+	assert.Equal(t, 3, serve(t, handler, http.MethodGet, "/api/v1/goods/x/provenance", "").Code)
+}
+
+func TestGoodController_History(t *testing.T) {
+	handler, _ := newGoodServer(t)
+
+	history := func(target string) []*store.Observation {
+		r := serve(t, handler, http.MethodGet, target, "")
+		if !assert.Equal(t, 0, r.Code, target) {
+			return nil
+		}
+		data := struct {
+			List []*store.Observation `json:"list"`
+		}{}
+		assert.NoError(t, json.Unmarshal(r.Data, &data))
+		return data.List
+	}
+
+	list := history("/api/v1/goods/a/history")
+	if assert.Len(t, list, 2) {
+		assert.Equal(t, 59.9, list[0].Price)
+		assert.Equal(t, 49.9, list[1].Price)
+	}
+	assert.Len(t, history("/api/v1/goods/a/history?start=150"), 1)
+	assert.Len(t, history("/api/v1/goods/a/history?start=300"), 0)
+	assert.Len(t, history("/api/v1/goods/b/history"), 0)
+
+	// 宝贝不存在时是否指定时间范围结果相同
+	assert.Equal(t, 3, serve(t, handler, http.MethodGet, "/api/v1/goods/x/history", "").Code)
+	assert.Equal(t, 3, serve(t, handler, http.MethodGet, "/api/v1/goods/x/history?start=1&end=300", "").Code)
+}
+
+func TestGoodController_Patch(t *testing.T) {
+	handler, s := newGoodServer(t)
+	target := fmt.Sprintf("/api/v1/goods/%d", idOf(t, s, "a"))
+
+	r := serve(t, handler, http.MethodPatch, target, `{"state": "shortlisted", "notes": "ok", "reviewer": "lack"}`)
+	if assert.Equal(t, 0, r.Code) {
+		good, err := s.GetGoodByUID("a")
+		if assert.NoError(t, err) {
+			assert.Equal(t, store.StateShortlisted, good.State)
+			assert.Equal(t, "ok", good.Notes)
+		}
+	}
+
+	assert.Equal(t, 3, serve(t, handler, http.MethodPatch, target, `{"state": `).Code)
+	assert.Equal(t, 3, serve(t, handler, http.MethodPatch, target, `{"state": "unknown"}`).Code)
+	assert.Equal(t, 3, serve(t, handler, http.MethodPatch, "/api/v1/goods/x", `{"notes": "ok"}`).Code)
+	assert.Equal(t, 3, serve(t, handler, http.MethodPatch, "/api/v1/goods/1000", `{"notes": "ok"}`).Code)
+}
+
+func TestGoodController_SetState(t *testing.T) {
+	handler, s := newGoodServer(t)
+
+	r := serve(t, handler, http.MethodPost, "/api/v1/goods/action/state?minPrice=20", `{"state": "rejected"}`)
+	if assert.Equal(t, 0, r.Code) {
+		assert.JSONEq(t, `{"total": 1}`, string(r.Data))
+	}
+	body := fmt.Sprintf(`{"ids": [%d], "state": "listed"}`, idOf(t, s, "b"))
+	r = serve(t, handler, http.MethodPost, "/api/v1/goods/action/state", body)
+	if assert.Equal(t, 0, r.Code) {
+		assert.JSONEq(t, `{"total": 1}`, string(r.Data))
+	}
+	r = serve(t, handler, http.MethodGet, "/api/v1/goods?state=rejected", "")
+	if assert.Equal(t, 0, r.Code) {
+		assert.Equal(t, []string{"a"}, uids(t, r))
+	}
+
+	for _, body := range []string{`{"ids": [1], "state": `, `{"ids": [1]}`, `{"ids": [1], "state": "unknown"}`} {
+		assert.Equal(t, 3, serve(t, handler, http.MethodPost, "/api/v1/goods/action/state", body).Code, body)
+	}
+	assert.Equal(t, 3, serve(t, handler, http.MethodPost, "/api/v1/goods/action/state?sort=color", `{"state": "new"}`).Code)
+}
+
+func TestGoodController_Trash(t *testing.T) {
+	handler, s := newGoodServer(t)
+	a, b := idOf(t, s, "a"), idOf(t, s, "b")
+
+	r := serve(t, handler, http.MethodDelete, fmt.Sprintf("/api/v1/goods/%d", a), "")
+	assert.Equal(t, 0, r.Code)
+	assert.Equal(t, 3, serve(t, handler, http.MethodDelete, fmt.Sprintf("/api/v1/goods/%d", a), "").Code)
+
+	r = serve(t, handler, http.MethodPost, "/api/v1/goods/action/delete", fmt.Sprintf(`{"ids": [%d]}`, b))
+	if assert.Equal(t, 0, r.Code) {
+		assert.JSONEq(t, `{"total": 1}`, string(r.Data))
+	}
+
+	r = serve(t, handler, http.MethodGet, "/api/v1/goods/trash?sort=price:desc", "")
+	if assert.Equal(t, 0, r.Code) {
+		assert.Equal(t, []string{"a", "b"}, uids(t, r))
+	}
+	r = serve(t, handler, http.MethodGet, "/api/v1/goods", "")
+	if assert.Equal(t, 0, r.Code) {
+		assert.Empty(t, uids(t, r))
+	}
+
+	r = serve(t, handler, http.MethodPost, "/api/v1/goods/action/restore?minPrice=20", "")
+	if assert.Equal(t, 0, r.Code) {
+		assert.JSONEq(t, `{"total": 1}`, string(r.Data))
+	}
+	r = serve(t, handler, http.MethodGet, "/api/v1/goods", "")
+	if assert.Equal(t, 0, r.Code) {
+		assert.Equal(t, []string{"a"}, uids(t, r))
+	}
+
+	// 没有条件或者请求体无效时不会操作所有的宝贝
+	for _, action := range []string{"delete", "restore"} {
+		target := "/api/v1/goods/action/" + action
+		assert.Equal(t, 3, serve(t, handler, http.MethodPost, target, "").Code, target)
+		assert.Equal(t, 3, serve(t, handler, http.MethodPost, target+"?minPrice=20", `{"ids": `).Code, target)
+	}
+}
@@ -12,4 +12,3 @@ func DefaultQueryInt64(ctx *gin.Context, key string, de int64) int64 {
 	n, _ := strconv.ParseInt(page, 10, 64)
 	return n
 }
-
@@ -0,0 +1,130 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/lack-io/cirrus/storage"
+)
+
+func RegistryStorageController(s storage.Storage, handler *gin.RouterGroup) {
+	controller := storageController{s: s}
+	group := handler.Group("/v1/storage")
+	{
+		group.GET("/dead", controller.getDead())
+		group.POST("/dead/action/requeue", controller.requeueDead())
+		group.GET("/snapshot", controller.exportSnapshot())
+		group.POST("/snapshot", controller.importSnapshot())
+	}
+}
+
+type storageController struct {
+	s storage.Storage
+}
+
+// namespace 返回请求参数 namespace 对应的 storage，默认为 default，命名空间无效时返回 ErrInvalidNamespace
+func (c *storageController) namespace(ctx *gin.Context) (string, storage.Storage, error) {
+	ns := ctx.DefaultQuery("namespace", storage.DefaultNamespace)
+	if err := storage.CheckNamespace(ns); err != nil {
+		return "", nil, err
+	}
+	return ns, c.s.Namespace(ns), nil
+}
+
+func (c *storageController) getDead() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		_, s, err := c.namespace(ctx)
+		if err != nil {
+			R().Ctx(ctx).Bad(err)
+			return
+		}
+		urls, err := s.Dead()
+		if err != nil {
+			R().Ctx(ctx).Fail(err)
+			return
+		}
+
+		R().Ctx(ctx).OK(gin.H{
+			"list":  urls,
+			"total": len(urls),
+		})
+		return
+	}
+}
+
+func (c *storageController) requeueDead() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		type data struct {
+			Paths []string `json:"paths,omitempty"`
+		}
+
+		d := data{}
+		ctx.BindJSON(&d)
+		if len(d.Paths) == 0 {
+			R().Ctx(ctx).Bad(fmt.Errorf("缺少 paths 参数"))
+			return
+		}
+
+		_, s, err := c.namespace(ctx)
+		if err != nil {
+			R().Ctx(ctx).Bad(err)
+			return
+		}
+		for _, path := range d.Paths {
+			if err := s.Requeue(path); err != nil {
+				R().Ctx(ctx).Fail(err)
+				return
+			}
+		}
+
+		R().Ctx(ctx).OK(gin.H{"total": len(d.Paths)})
+		return
+	}
+}
+
+// exportSnapshot 以 JSONL 的格式下载命名空间中所有的 url
+func (c *storageController) exportSnapshot() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		ns, s, err := c.namespace(ctx)
+		if err != nil {
+			R().Ctx(ctx).Bad(err)
+			return
+		}
+
+		ctx.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%s.jsonl", ns))
+		ctx.Header("Content-Type", "application/x-ndjson")
+		ctx.Status(http.StatusOK)
+		// 响应已经开始写入，导出失败时只能中断响应
+		if _, err := storage.Export(s, ctx.Writer); err != nil {
+			_ = ctx.Error(err)
+			ctx.Abort()
+		}
+		return
+	}
+}
+
+// importSnapshot 将请求体中 JSONL 格式的快照导入命名空间
+func (c *storageController) importSnapshot() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		_, s, err := c.namespace(ctx)
+		if err != nil {
+			R().Ctx(ctx).Bad(err)
+			return
+		}
+		n, err := storage.Import(s, ctx.Request.Body)
+		if errors.Is(err, storage.ErrSnapshot) {
+			R().Ctx(ctx).Bad(err)
+			return
+		}
+		if err != nil {
+			R().Ctx(ctx).Fail(err)
+			return
+		}
+
+		R().Ctx(ctx).OK(gin.H{"total": n})
+		return
+	}
+}
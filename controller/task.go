@@ -3,10 +3,12 @@ package controller
 import (
 	"fmt"
 	"sync"
+	"time"
 
 	"github.com/gin-gonic/gin"
 
 	"github.com/lack-io/cirrus/internal/daemon"
+	"github.com/lack-io/cirrus/storage"
 )
 
 type TaskState string
@@ -15,11 +17,16 @@ const (
 	Free    TaskState = "free"
 	Running TaskState = "running"
 	Pending TaskState = "pending"
+	Paused  TaskState = "paused"
 )
 
 // 抓取任务
 type Task struct {
-	Root string `json:"root,omitempty"`
+	// 任务的命名空间
+	Namespace string `json:"namespace,omitempty"`
+	Root      string `json:"root,omitempty"`
+	// 任务的最大深度
+	MaxDepth int `json:"maxDepth,omitempty"`
 	// 任务状态
 	State TaskState `json:"state,omitempty"`
 	// 任务开始时间
@@ -33,7 +40,10 @@ func RegistryTaskController(d daemon.Daemon, handler *gin.RouterGroup) {
 	controller := taskController{task: task, lock: &sync.RWMutex{}, d: d}
 	group := handler.Group("/v1/task/")
 	{
+		group.GET("", controller.getTask())
 		group.POST("action/start", controller.startTask())
+		group.POST("action/pause", controller.pauseTask())
+		group.POST("action/resume", controller.resumeTask())
 		group.POST("action/clear", controller.clearTask())
 	}
 }
@@ -46,13 +56,24 @@ type taskController struct {
 	d daemon.Daemon
 }
 
+func (c *taskController) getTask() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		c.lock.RLock()
+		defer c.lock.RUnlock()
+
+		R().Ctx(ctx).OK(c.task)
+	}
+}
+
 func (c *taskController) startTask() gin.HandlerFunc {
 	return func(ctx *gin.Context) {
 		c.lock.Lock()
 		defer c.lock.Unlock()
 
 		type data struct {
-			Root string `json:"root,omitempty"`
+			Namespace string `json:"namespace,omitempty"`
+			Root      string `json:"root,omitempty"`
+			MaxDepth  int    `json:"maxDepth,omitempty"`
 		}
 
 		d := data{}
@@ -61,20 +82,102 @@ func (c *taskController) startTask() gin.HandlerFunc {
 			R().Ctx(ctx).Bad(fmt.Errorf("缺少 root 参数"))
 			return
 		}
+		if d.MaxDepth < 0 {
+			R().Ctx(ctx).Bad(fmt.Errorf("maxDepth 参数无效"))
+			return
+		}
+		if d.Namespace == "" {
+			d.Namespace = storage.DefaultNamespace
+		}
+		if err := storage.CheckNamespace(d.Namespace); err != nil {
+			R().Ctx(ctx).Bad(err)
+			return
+		}
 
-		c.d.StartDaemon(d.Root)
+		err := c.d.StartDaemon(daemon.Options{Namespace: d.Namespace, Root: d.Root, MaxDepth: d.MaxDepth})
+		if err != nil {
+			R().Ctx(ctx).Fail(err)
+			return
+		}
+		*c.task = Task{
+			Namespace: d.Namespace,
+			Root:      d.Root,
+			MaxDepth:  d.MaxDepth,
+			State:     Running,
+			StartTime: time.Now().Unix(),
+		}
 
 		R().Ctx(ctx).Accepted()
 		return
 	}
 }
 
+// pauseTask 暂停当前的任务，正在爬取的 url 会继续完成，未爬取的 url 保留在 storage 中
+func (c *taskController) pauseTask() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		c.lock.Lock()
+		defer c.lock.Unlock()
+
+		if err := c.d.PauseDaemon(); err != nil {
+			R().Ctx(ctx).Fail(err)
+			return
+		}
+		if c.task.State == Running {
+			c.task.State = Paused
+		}
+
+		R().Ctx(ctx).Accepted()
+		return
+	}
+}
+
+// resumeTask 从暂停前的状态继续当前的任务
+func (c *taskController) resumeTask() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		c.lock.Lock()
+		defer c.lock.Unlock()
+
+		if err := c.d.ResumeDaemon(); err != nil {
+			R().Ctx(ctx).Fail(err)
+			return
+		}
+		if c.task.State == Paused {
+			c.task.State = Running
+		}
+
+		R().Ctx(ctx).Accepted()
+		return
+	}
+}
+
+// clearTask 清空命名空间中的 url，清空当前任务的命名空间时任务结束
 func (c *taskController) clearTask() gin.HandlerFunc {
 	return func(ctx *gin.Context) {
 		c.lock.Lock()
 		defer c.lock.Unlock()
 
-		c.d.PauseDaemon()
+		type data struct {
+			Namespace string `json:"namespace,omitempty"`
+		}
+
+		d := data{}
+		ctx.BindJSON(&d)
+		// 未指定命名空间时清空当前任务的命名空间
+		if d.Namespace != "" {
+			if err := storage.CheckNamespace(d.Namespace); err != nil {
+				R().Ctx(ctx).Bad(err)
+				return
+			}
+		}
+
+		if err := c.d.ClearDaemon(d.Namespace); err != nil {
+			R().Ctx(ctx).Fail(err)
+			return
+		}
+		if c.task.State != Free && (d.Namespace == "" || d.Namespace == c.task.Namespace) {
+			c.task.State = Free
+			c.task.EndTime = time.Now().Unix()
+		}
 
 		R().Ctx(ctx).Accepted()
 		return
@@ -5,17 +5,20 @@ go 1.15
 require (
 	github.com/BurntSushi/toml v0.3.1
 	github.com/PuerkitoBio/goquery v1.6.0
+	github.com/alicebob/miniredis/v2 v2.30.5
 	github.com/chromedp/chromedp v0.5.3
 	github.com/emirpasic/gods v1.12.0
-	github.com/gin-gonic/gin v1.6.3
+	github.com/gin-gonic/gin v1.7.7
 	github.com/go-redis/redis/v8 v8.3.3
 	github.com/json-iterator/go v1.1.10
+	github.com/mattn/go-sqlite3 v1.14.16 // indirect
 	github.com/natefinch/lumberjack v2.0.0+incompatible
 	github.com/stretchr/testify v1.6.1
 	go.uber.org/atomic v1.6.0
 	go.uber.org/zap v1.16.0
 	golang.org/x/net v0.0.0-20201110031124-69a78807bb2b
 	gopkg.in/natefinch/lumberjack.v2 v2.0.0 // indirect
+	gorm.io/driver/postgres v1.0.5
 	gorm.io/driver/sqlite v1.1.3
 	gorm.io/gorm v1.20.6
 )
@@ -0,0 +1,41 @@
+// 布隆过滤器的参数计算和 hash 位置计算，bit 数组由调用方保存 (例如 redis bitmap)
+package bloom
+
+import (
+	"encoding/binary"
+	"hash/fnv"
+	"math"
+)
+
+// Estimate 根据预计的元素个数 n 和误判率 p 计算 bit 数组的长度 m 和 hash 函数的个数 k
+func Estimate(n uint64, p float64) (m uint64, k uint64) {
+	if n == 0 {
+		n = 1
+	}
+	if p <= 0 || p >= 1 {
+		p = 0.01
+	}
+
+	m = uint64(math.Ceil(-float64(n) * math.Log(p) / (math.Ln2 * math.Ln2)))
+	k = uint64(math.Ceil(math.Ln2 * float64(m) / float64(n)))
+	if k == 0 {
+		k = 1
+	}
+	return m, k
+}
+
+// Locations 返回 data 在长度为 m 的 bit 数组中对应的 k 个位置
+func Locations(data []byte, k, m uint64) []uint64 {
+	// 使用 128 位的 fnv hash 拆分成两个 hash 值，通过 h1 + i*h2 生成 k 个 hash 值
+	h := fnv.New128a()
+	_, _ = h.Write(data)
+	sum := h.Sum(nil)
+	h1 := binary.BigEndian.Uint64(sum[:8])
+	h2 := binary.BigEndian.Uint64(sum[8:])
+
+	locations := make([]uint64, k)
+	for i := uint64(0); i < k; i++ {
+		locations[i] = (h1 + i*h2) % m
+	}
+	return locations
+}
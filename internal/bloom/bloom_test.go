@@ -0,0 +1,44 @@
+package bloom
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEstimate(t *testing.T) {
+	m, k := Estimate(1000000, 0.01)
+
+	assert.Equal(t, uint64(9585059), m)
+	assert.Equal(t, uint64(7), k)
+}
+
+func TestLocations(t *testing.T) {
+	n, p := uint64(10000), 0.01
+	m, k := Estimate(n, p)
+
+	bits := make([]bool, m)
+	for i := uint64(0); i < n; i++ {
+		for _, l := range Locations([]byte(fmt.Sprintf("https://www.cdiscount.com/f-%d.html", i)), k, m) {
+			bits[l] = true
+		}
+	}
+
+	var fp int
+	for i := uint64(0); i < n; i++ {
+		hit := true
+		for _, l := range Locations([]byte(fmt.Sprintf("https://www.cdiscount.com/g-%d.html", i)), k, m) {
+			if !bits[l] {
+				hit = false
+				break
+			}
+		}
+		if hit {
+			fp++
+		}
+	}
+
+	// 误判率不应该明显超过预期
+	assert.Less(t, float64(fp)/float64(n), p*2)
+}
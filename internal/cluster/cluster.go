@@ -0,0 +1,460 @@
+// 集群模块，多个 cirrus 实例通过 redis 注册、发送心跳，并选举一个协调者负责启动和清空任务
+package cluster
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+
+	"github.com/lack-io/cirrus/config"
+)
+
+const (
+	prefix = "/cirrus/cluster"
+
+	// DefaultHeartbeat 默认的心跳间隔
+	DefaultHeartbeat = time.Second * 5
+
+	// DefaultTimeout 默认的心跳超时时间
+	DefaultTimeout = time.Second * 15
+)
+
+var (
+	// ErrNotCoordinator 当前实例不是集群的协调者
+	ErrNotCoordinator = errors.New("not the cluster coordinator")
+	// ErrNotJoined 当前实例没有加入集群
+	ErrNotJoined = errors.New("not joined the cluster")
+	// ErrNoTask 集群中没有任务
+	ErrNoTask = errors.New("no task in cluster")
+)
+
+// electScript 续约或者竞选协调者，当前实例是协调者时返回 1
+//
+//	KEYS[1]: coordinator
+//	ARGV[1]: 实例 ID
+//	ARGV[2]: 租约时间(单位为毫秒)
+var electScript = redis.NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	redis.call('PEXPIRE', KEYS[1], ARGV[2])
+	return 1
+end
+if redis.call('SET', KEYS[1], ARGV[1], 'NX', 'PX', ARGV[2]) then
+	return 1
+end
+return 0
+`)
+
+// resignScript 当前实例是协调者时放弃协调者的角色
+//
+//	KEYS[1]: coordinator
+//	ARGV[1]: 实例 ID
+var resignScript = redis.NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return redis.call('DEL', KEYS[1])
+end
+return 0
+`)
+
+// setTaskScript 当前实例是协调者时设置集群的任务，否则返回 0
+//
+//	KEYS[1]: coordinator
+//	KEYS[2]: task
+//	ARGV[1]: 实例 ID
+//	ARGV[2]: 任务
+var setTaskScript = redis.NewScript(`
+if redis.call('GET', KEYS[1]) ~= ARGV[1] then
+	return 0
+end
+redis.call('SET', KEYS[2], ARGV[2])
+return 1
+`)
+
+// Worker 集群中的实例
+type Worker struct {
+	// ID 实例的 ID
+	ID string `json:"id"`
+
+	// Host 实例所在的主机
+	Host string `json:"host"`
+
+	// Concurrency 实例的最大并发数
+	Concurrency int `json:"concurrency"`
+
+	// Running 实例正在爬取的 url 个数
+	Running int `json:"running"`
+
+	// Coordinator 实例是否为协调者
+	Coordinator bool `json:"coordinator"`
+
+	// Joined 实例加入集群的时间
+	Joined int64 `json:"joined"`
+
+	// Heartbeat 实例最后一次心跳的时间
+	Heartbeat int64 `json:"heartbeat"`
+}
+
+// Task 集群当前的任务，由协调者设置，所有的实例从任务的命名空间中获取 url
+type Task struct {
+	// Namespace 任务的命名空间
+	Namespace string `json:"namespace"`
+
+	// Root 任务的起始路径
+	Root string `json:"root,omitempty"`
+
+	// MaxDepth 任务的最大深度
+	MaxDepth int `json:"maxDepth,omitempty"`
+
+	// Paused 任务是否已经暂停，暂停的任务不会获取新的 url
+	Paused bool `json:"paused,omitempty"`
+
+	// Updated 任务的更新时间 (unix 纳秒时间戳)，实例通过更新时间判断任务是否发生变化
+	Updated int64 `json:"updated"`
+}
+
+// Member 加入集群的实例需要实现的接口
+type Member interface {
+	// Report 返回实例的最大并发数和正在爬取的 url 个数
+	Report() (concurrency, running int)
+
+	// Follow 集群的任务发生变化时调用
+	Follow(task Task)
+}
+
+// Options 集群参数
+type Options struct {
+	// ID 实例的 ID
+	ID string
+
+	// Heartbeat 心跳间隔
+	Heartbeat time.Duration
+
+	// Timeout 心跳超时时间，同时也是协调者的租约时间
+	Timeout time.Duration
+}
+
+// NewOptions 从配置中生成 Options，未配置的参数使用默认值
+func NewOptions(cfg *config.Cluster) Options {
+	opts := Options{Heartbeat: DefaultHeartbeat, Timeout: DefaultTimeout}
+	if cfg != nil {
+		opts.ID = cfg.ID
+		if cfg.Heartbeat > 0 {
+			opts.Heartbeat = time.Second * time.Duration(cfg.Heartbeat)
+		}
+		if cfg.Timeout > 0 {
+			opts.Timeout = time.Second * time.Duration(cfg.Timeout)
+		}
+	}
+	if opts.ID == "" {
+		host, _ := os.Hostname()
+		opts.ID = fmt.Sprintf("%s-%d", host, os.Getpid())
+	}
+	return opts
+}
+
+type Cluster struct {
+	ctx context.Context
+
+	opts Options
+
+	cli *redis.Client
+
+	// workers redis hash 表名称，存储实例的信息
+	workers string
+
+	// heartbeats redis 有序集合的名称，score 为实例最后一次心跳的时间
+	heartbeats string
+
+	// coordinator redis key 名称，value 为协调者的 ID，过期时间为协调者的租约
+	coordinator string
+
+	// task redis key 名称，存储集群当前的任务
+	task string
+
+	// lock 保证 Join, Leave 和心跳不会同时执行
+	lock sync.Mutex
+
+	member Member
+
+	// joined 加入集群的时间，为 0 时没有加入集群
+	joined int64
+
+	// updated 最后一次通知 member 的任务的更新时间
+	updated int64
+
+	// stop 停止心跳
+	stop chan struct{}
+
+	// done 心跳已经停止
+	done chan struct{}
+
+	// leader 当前实例是否为协调者
+	leader *atomic.Value
+}
+
+func New(ctx context.Context, cfg *config.StorageRedis, opts Options) *Cluster {
+	cli := redis.NewClient(&redis.Options{
+		Addr:         cfg.Addr,
+		Username:     cfg.Username,
+		Password:     cfg.Password,
+		DB:           0,
+		PoolSize:     cfg.Pools,
+		ReadTimeout:  time.Second * 10,
+		WriteTimeout: time.Second * 10,
+	})
+
+	c := &Cluster{
+		ctx:         ctx,
+		opts:        opts,
+		cli:         cli,
+		workers:     path.Join(prefix, "workers"),
+		heartbeats:  path.Join(prefix, "heartbeats"),
+		coordinator: path.Join(prefix, "coordinator"),
+		task:        path.Join(prefix, "task"),
+		leader:      &atomic.Value{},
+	}
+	c.leader.Store(false)
+
+	return c
+}
+
+// ID 返回实例的 ID
+func (c *Cluster) ID() string {
+	return c.opts.ID
+}
+
+// IsCoordinator 返回当前实例是否为协调者
+func (c *Cluster) IsCoordinator() bool {
+	return c.leader.Load().(bool)
+}
+
+// Join 将 member 注册到集群中，并定时发送心跳，实例加入后会立即跟随集群当前的任务
+func (c *Cluster) Join(member Member) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if c.joined != 0 {
+		return nil
+	}
+	if err := c.cli.Ping(c.ctx).Err(); err != nil {
+		return err
+	}
+
+	c.member = member
+	c.joined = time.Now().Unix()
+	if err := c.beat(time.Now()); err != nil {
+		c.joined = 0
+		return err
+	}
+
+	c.stop, c.done = make(chan struct{}), make(chan struct{})
+	go c.run(c.stop, c.done)
+	return nil
+}
+
+// Leave 停止心跳并将实例移出集群，协调者会同时放弃协调者的角色，由其他实例接替
+func (c *Cluster) Leave() error {
+	c.lock.Lock()
+	if c.joined == 0 {
+		c.lock.Unlock()
+		return nil
+	}
+	close(c.stop)
+	done := c.done
+	c.lock.Unlock()
+	<-done
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.joined = 0
+	c.leader.Store(false)
+	// ctx 可能已经结束，使用新的 context 确保实例能够被移除
+	ctx := context.Background()
+	_, err := c.cli.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.HDel(ctx, c.workers, c.opts.ID)
+		pipe.ZRem(ctx, c.heartbeats, c.opts.ID)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return resignScript.Run(ctx, c.cli, []string{c.coordinator}, c.opts.ID).Err()
+}
+
+func (c *Cluster) run(stop, done chan struct{}) {
+	defer close(done)
+
+	timer := time.NewTicker(c.opts.Heartbeat)
+	defer timer.Stop()
+	for {
+		select {
+		case <-c.ctx.Done():
+			return
+		case <-stop:
+			return
+		case now := <-timer.C:
+			c.lock.Lock()
+			_ = c.beat(now)
+			c.lock.Unlock()
+		}
+	}
+}
+
+// beat 发送一次心跳: 竞选协调者，更新实例信息，移除超时的实例，并跟随集群的任务，调用前需要持有 lock
+func (c *Cluster) beat(now time.Time) error {
+	n, err := electScript.Run(c.ctx, c.cli, []string{c.coordinator}, c.opts.ID, c.opts.Timeout.Milliseconds()).Int()
+	if err != nil {
+		c.leader.Store(false)
+		return err
+	}
+	c.leader.Store(n == 1)
+
+	host, _ := os.Hostname()
+	w := &Worker{
+		ID:          c.opts.ID,
+		Host:        host,
+		Coordinator: n == 1,
+		Joined:      c.joined,
+		Heartbeat:   now.Unix(),
+	}
+	w.Concurrency, w.Running = c.member.Report()
+	data, err := json.Marshal(w)
+	if err != nil {
+		return err
+	}
+
+	_, err = c.cli.TxPipelined(c.ctx, func(pipe redis.Pipeliner) error {
+		pipe.HSet(c.ctx, c.workers, c.opts.ID, data)
+		pipe.ZAdd(c.ctx, c.heartbeats, &redis.Z{Score: float64(now.Unix()), Member: c.opts.ID})
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if err = c.prune(now); err != nil {
+		return err
+	}
+
+	task, err := c.Task()
+	if errors.Is(err, ErrNoTask) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if task.Updated != c.updated {
+		c.updated = task.Updated
+		c.member.Follow(*task)
+	}
+	return nil
+}
+
+// prune 移除心跳超时的实例
+func (c *Cluster) prune(now time.Time) error {
+	max := strconv.FormatInt(now.Add(-c.opts.Timeout).Unix(), 10)
+	ids, err := c.cli.ZRangeByScore(c.ctx, c.heartbeats, &redis.ZRangeBy{Min: "-inf", Max: "(" + max}).Result()
+	if err != nil || len(ids) == 0 {
+		return err
+	}
+
+	_, err = c.cli.TxPipelined(c.ctx, func(pipe redis.Pipeliner) error {
+		pipe.HDel(c.ctx, c.workers, ids...)
+		members := make([]interface{}, 0, len(ids))
+		for _, id := range ids {
+			members = append(members, id)
+		}
+		pipe.ZRem(c.ctx, c.heartbeats, members...)
+		return nil
+	})
+	return err
+}
+
+// Coordinator 返回协调者的 ID，没有协调者时返回空字符串
+func (c *Cluster) Coordinator() (string, error) {
+	id, err := c.cli.Get(c.ctx, c.coordinator).Result()
+	if err == redis.Nil {
+		return "", nil
+	}
+	return id, err
+}
+
+// Workers 返回集群中所有的实例，按照 ID 排序
+func (c *Cluster) Workers() ([]*Worker, error) {
+	values, err := c.cli.HGetAll(c.ctx, c.workers).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	deadline := time.Now().Add(-c.opts.Timeout).Unix()
+	workers := make([]*Worker, 0, len(values))
+	for _, data := range values {
+		w := &Worker{}
+		if err = json.Unmarshal([]byte(data), w); err != nil {
+			continue
+		}
+		// 还没有被移除的超时实例
+		if w.Heartbeat < deadline {
+			continue
+		}
+		workers = append(workers, w)
+	}
+	sort.Slice(workers, func(i, j int) bool { return workers[i].ID < workers[j].ID })
+	return workers, nil
+}
+
+// Task 返回集群当前的任务
+func (c *Cluster) Task() (*Task, error) {
+	data, err := c.cli.Get(c.ctx, c.task).Bytes()
+	if err == redis.Nil {
+		return nil, ErrNoTask
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	task := &Task{}
+	if err = json.Unmarshal(data, task); err != nil {
+		return nil, err
+	}
+	return task, nil
+}
+
+// SetTask 设置集群当前的任务，只有协调者可以设置，其他实例在下一次心跳时跟随新的任务
+func (c *Cluster) SetTask(task Task) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if c.joined == 0 {
+		return ErrNotJoined
+	}
+
+	task.Updated = time.Now().UnixNano()
+	data, err := json.Marshal(task)
+	if err != nil {
+		return err
+	}
+	// 协调者的租约可能已经过期，需要在 redis 中确认当前实例仍然是协调者
+	n, err := setTaskScript.Run(c.ctx, c.cli, []string{c.coordinator, c.task}, c.opts.ID, data).Int()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		c.leader.Store(false)
+		return ErrNotCoordinator
+	}
+
+	c.updated = task.Updated
+	c.member.Follow(task)
+	return nil
+}
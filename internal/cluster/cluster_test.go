@@ -0,0 +1,155 @@
+package cluster
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/lack-io/cirrus/config"
+)
+
+type member struct {
+	lock  sync.Mutex
+	tasks []Task
+}
+
+func (m *member) Report() (int, int) { return 10, 2 }
+
+func (m *member) Follow(task Task) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.tasks = append(m.tasks, task)
+}
+
+func (m *member) last() Task {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if len(m.tasks) == 0 {
+		return Task{}
+	}
+	return m.tasks[len(m.tasks)-1]
+}
+
+func newCluster(t *testing.T, s *miniredis.Miniredis, id string) *Cluster {
+	return New(context.Background(), &config.StorageRedis{Addr: s.Addr(), Pools: 2}, Options{
+		ID:        id,
+		Heartbeat: time.Hour,
+		Timeout:   time.Second * 15,
+	})
+}
+
+// beat 立即发送一次心跳
+func beat(t *testing.T, c *Cluster, now time.Time) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if err := c.beat(now); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCluster_Join(t *testing.T) {
+	s := miniredis.RunT(t)
+	a, b := newCluster(t, s, "a"), newCluster(t, s, "b")
+	ma, mb := &member{}, &member{}
+
+	assert.Equal(t, ErrNotJoined, a.SetTask(Task{Namespace: "x"}))
+	assert.NoError(t, a.Join(ma))
+	assert.NoError(t, b.Join(mb))
+	assert.True(t, a.IsCoordinator())
+	assert.False(t, b.IsCoordinator())
+
+	id, err := b.Coordinator()
+	assert.NoError(t, err)
+	assert.Equal(t, "a", id)
+
+	workers, err := b.Workers()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if assert.Equal(t, 2, len(workers)) {
+		assert.Equal(t, "a", workers[0].ID)
+		assert.True(t, workers[0].Coordinator)
+		assert.Equal(t, 10, workers[1].Concurrency)
+		assert.Equal(t, 2, workers[1].Running)
+	}
+}
+
+func TestCluster_SetTask(t *testing.T) {
+	s := miniredis.RunT(t)
+	a, b := newCluster(t, s, "a"), newCluster(t, s, "b")
+	ma, mb := &member{}, &member{}
+	assert.NoError(t, a.Join(ma))
+	assert.NoError(t, b.Join(mb))
+
+	_, err := b.Task()
+	assert.Equal(t, ErrNoTask, err)
+
+	// 只有协调者可以设置任务
+	assert.Equal(t, ErrNotCoordinator, b.SetTask(Task{Namespace: "x"}))
+	assert.NoError(t, a.SetTask(Task{Namespace: "x", Root: "https://www.cdiscount.com", MaxDepth: 3}))
+	assert.Equal(t, "x", ma.last().Namespace)
+	assert.Equal(t, "", mb.last().Namespace)
+
+	// 其他实例在下一次心跳时跟随新的任务
+	beat(t, b, time.Now())
+	assert.Equal(t, "x", mb.last().Namespace)
+	assert.Equal(t, 3, mb.last().MaxDepth)
+
+	// 任务没有变化时不会重复通知
+	beat(t, b, time.Now())
+	assert.Equal(t, 1, len(mb.tasks))
+
+	// 新加入的实例立即跟随集群的任务
+	mc := &member{}
+	assert.NoError(t, newCluster(t, s, "c").Join(mc))
+	assert.Equal(t, "x", mc.last().Namespace)
+
+	// 暂停任务时其他实例保持相同的命名空间
+	task := ma.last()
+	task.Paused = true
+	assert.NoError(t, a.SetTask(task))
+	beat(t, b, time.Now().Add(time.Second))
+	assert.True(t, mb.last().Paused)
+	assert.Equal(t, "x", mb.last().Namespace)
+}
+
+func TestCluster_Leave(t *testing.T) {
+	s := miniredis.RunT(t)
+	a, b := newCluster(t, s, "a"), newCluster(t, s, "b")
+	assert.NoError(t, a.Join(&member{}))
+	assert.NoError(t, b.Join(&member{}))
+
+	assert.NoError(t, a.Leave())
+	assert.NoError(t, a.Leave())
+	assert.False(t, a.IsCoordinator())
+	assert.Equal(t, ErrNotJoined, a.SetTask(Task{Namespace: "x"}))
+
+	// 协调者离开后由其他实例接替
+	beat(t, b, time.Now())
+	assert.True(t, b.IsCoordinator())
+	workers, _ := b.Workers()
+	if assert.Equal(t, 1, len(workers)) {
+		assert.Equal(t, "b", workers[0].ID)
+	}
+}
+
+func TestCluster_Timeout(t *testing.T) {
+	s := miniredis.RunT(t)
+	a, b := newCluster(t, s, "a"), newCluster(t, s, "b")
+	assert.NoError(t, a.Join(&member{}))
+	assert.NoError(t, b.Join(&member{}))
+
+	// a 停止发送心跳，协调者的租约过期后 b 接替协调者，并移除 a
+	s.FastForward(time.Second * 16)
+	beat(t, b, time.Now().Add(time.Second*16))
+	assert.True(t, b.IsCoordinator())
+	assert.Equal(t, ErrNotCoordinator, a.SetTask(Task{Namespace: "x"}))
+	assert.False(t, a.IsCoordinator())
+
+	n, _ := s.ZMembers(b.heartbeats)
+	assert.Equal(t, []string{"b"}, n)
+}
@@ -1,6 +1,24 @@
 package daemon
 
+// Options 抓取任务的参数
+type Options struct {
+	// Namespace 任务的命名空间，不同命名空间的任务可以共享同一个 storage
+	Namespace string
+
+	// Root 任务的起始路径
+	Root string
+
+	// MaxDepth 从起始路径开始爬取的最大深度，为 0 时使用配置文件中的 max_depth
+	MaxDepth int
+}
+
 type Daemon interface {
-	StartDaemon(root string)
-	PauseDaemon()
+	// StartDaemon 在 opts.Namespace 中从 opts.Root 开始抓取
+	StartDaemon(opts Options) error
+	// PauseDaemon 暂停当前的任务，不再获取新的 url，storage 中的 url 保持不变
+	PauseDaemon() error
+	// ResumeDaemon 继续当前的任务，从暂停前的状态继续抓取
+	ResumeDaemon() error
+	// ClearDaemon 清空命名空间 namespace 中的 url，namespace 为空时清空当前的命名空间
+	ClearDaemon(namespace string) error
 }
@@ -54,4 +54,14 @@ func (p *Parser) Text(sel string) string {
 // Html 返回指定元素的 html 内容
 func (p *Parser) Html(sel string) (string, error) {
 	return p.doc.Find(sel).Html()
-}
\ No newline at end of file
+}
+
+// First 返回第一个指定元素的文本内容，去掉首尾的空白字符
+func (p *Parser) First(sel string) string {
+	return strings.TrimSpace(p.doc.Find(sel).First().Text())
+}
+
+// Attr 返回第一个指定元素的属性 name 的值，元素或者属性不存在时返回 false
+func (p *Parser) Attr(sel, name string) (string, bool) {
+	return p.doc.Find(sel).First().Attr(name)
+}
@@ -0,0 +1,142 @@
+// url 规范化模块，保证爬虫和 storage 使用同一种格式的 url
+package urlx
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+var (
+	// ErrScheme 不支持的协议，例如 javascript:, mailto:
+	ErrScheme = errors.New("unsupported url scheme")
+	// ErrParse 解析 url 失败
+	ErrParse = errors.New("parse url")
+)
+
+// Options 规范化参数
+type Options struct {
+	// Scheme 统一使用的协议，为空时保留原来的协议
+	Scheme string
+
+	// Hosts 域名别名，key 为别名，value 为规范的域名
+	Hosts map[string]string
+
+	// Params 需要去除的查询参数，以 * 结尾时按照前缀匹配
+	Params []string
+}
+
+// Canonicalizer url 规范化
+type Canonicalizer struct {
+	opts Options
+
+	// params 需要去除的查询参数
+	params map[string]struct{}
+
+	// prefixes 需要去除的查询参数的前缀
+	prefixes []string
+}
+
+func New(opts Options) *Canonicalizer {
+	c := &Canonicalizer{
+		opts:     opts,
+		params:   map[string]struct{}{},
+		prefixes: make([]string, 0),
+	}
+
+	for _, param := range opts.Params {
+		param = strings.ToLower(param)
+		if strings.HasSuffix(param, "*") {
+			c.prefixes = append(c.prefixes, strings.TrimSuffix(param, "*"))
+			continue
+		}
+		c.params[param] = struct{}{}
+	}
+
+	return c
+}
+
+// Resolve 将页面 base 中的链接 href 解析为绝对路径，并规范化
+func (c *Canonicalizer) Resolve(base, href string) (string, error) {
+	b, err := url.Parse(strings.TrimSpace(base))
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrParse, err)
+	}
+	h, err := url.Parse(strings.TrimSpace(href))
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrParse, err)
+	}
+
+	return c.canonical(b.ResolveReference(h))
+}
+
+// Canonical 规范化绝对路径 raw
+func (c *Canonicalizer) Canonical(raw string) (string, error) {
+	u, err := url.Parse(strings.TrimSpace(raw))
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrParse, err)
+	}
+
+	// ResolveReference 会处理路径中的 . 和 ..
+	return c.canonical(u.ResolveReference(&url.URL{}))
+}
+
+func (c *Canonicalizer) canonical(u *url.URL) (string, error) {
+	u.Scheme = strings.ToLower(u.Scheme)
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return "", fmt.Errorf("%w: %q", ErrScheme, u.Scheme)
+	}
+	if u.Host == "" {
+		return "", fmt.Errorf("%w: missing host", ErrParse)
+	}
+
+	host, port := strings.ToLower(u.Hostname()), u.Port()
+	if alias, ok := c.opts.Hosts[host]; ok {
+		host = alias
+	}
+	// 去除协议的默认端口
+	if (u.Scheme == "http" && port == "80") || (u.Scheme == "https" && port == "443") {
+		port = ""
+	}
+	if c.opts.Scheme != "" {
+		u.Scheme = c.opts.Scheme
+	}
+	u.Host = host
+	if port != "" {
+		u.Host = host + ":" + port
+	}
+
+	u.User = nil
+	u.Fragment = ""
+	u.RawFragment = ""
+	if u.Path == "" {
+		u.Path = "/"
+	}
+
+	query := u.Query()
+	for key := range query {
+		if c.tracking(key) {
+			query.Del(key)
+		}
+	}
+	// Encode 会按照参数名排序，相同参数不同顺序的 url 会得到同一个结果
+	u.RawQuery = query.Encode()
+	u.ForceQuery = false
+
+	return u.String(), nil
+}
+
+// tracking 判断查询参数是否需要去除
+func (c *Canonicalizer) tracking(key string) bool {
+	key = strings.ToLower(key)
+	if _, ok := c.params[key]; ok {
+		return true
+	}
+	for _, prefix := range c.prefixes {
+		if strings.HasPrefix(key, prefix) {
+			return true
+		}
+	}
+	return false
+}
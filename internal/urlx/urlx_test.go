@@ -0,0 +1,63 @@
+package urlx
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var canon = New(Options{
+	Scheme: "https",
+	Hosts: map[string]string{
+		"cdiscount.com":   "www.cdiscount.com",
+		"m.cdiscount.com": "www.cdiscount.com",
+	},
+	Params: []string{"utm_*", "refer"},
+})
+
+func TestCanonicalizer_Resolve(t *testing.T) {
+	base := "https://www.cdiscount.com/informatique/r-clavier.html"
+
+	cases := []struct {
+		href   string
+		expect string
+	}{
+		{"/f-1070-abc.html", "https://www.cdiscount.com/f-1070-abc.html"},
+		{"f-1070-abc.html", "https://www.cdiscount.com/informatique/f-1070-abc.html"},
+		{"../f-1070-abc.html", "https://www.cdiscount.com/f-1070-abc.html"},
+		{"//m.cdiscount.com/f-1070-abc.html", "https://www.cdiscount.com/f-1070-abc.html"},
+		{"http://WWW.Cdiscount.com:80/f-1070-abc.html#reviews", "https://www.cdiscount.com/f-1070-abc.html"},
+		{"https://cdiscount.com/f-1070-abc.html?utm_source=a&refer=b&page=2", "https://www.cdiscount.com/f-1070-abc.html?page=2"},
+		{"https://www.cdiscount.com/search.html?b=2&a=1", "https://www.cdiscount.com/search.html?a=1&b=2"},
+		{"  https://www.cdiscount.com  ", "https://www.cdiscount.com/"},
+	}
+
+	for _, c := range cases {
+		v, err := canon.Resolve(base, c.href)
+		if err != nil {
+			t.Fatalf("resolve %s: %v", c.href, err)
+		}
+		assert.Equal(t, c.expect, v, c.href)
+	}
+}
+
+func TestCanonicalizer_Scheme(t *testing.T) {
+	base := "https://www.cdiscount.com/"
+
+	for _, href := range []string{"javascript:void(0)", "mailto:a@cdiscount.com", "tel:0102030405"} {
+		_, err := canon.Resolve(base, href)
+		assert.True(t, errors.Is(err, ErrScheme), href)
+	}
+}
+
+func TestCanonicalizer_Canonical(t *testing.T) {
+	v, err := canon.Canonical("http://m.cdiscount.com/a/./b/../f-1.html?UTM_medium=x")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "https://www.cdiscount.com/a/f-1.html", v)
+
+	_, err = canon.Canonical("/f-1.html")
+	assert.True(t, errors.Is(err, ErrScheme))
+}
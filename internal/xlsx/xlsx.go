@@ -0,0 +1,152 @@
+// Package xlsx 以流的方式写入只有一个工作表的 xlsx 文件，写入的行不会保存在内存中
+package xlsx
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+var (
+	// ErrClosed Writer 已经关闭
+	ErrClosed = errors.New("xlsx writer closed")
+)
+
+// xlsx 文件中除了工作表以外的固定内容
+var files = []struct {
+	name    string
+	content string
+}{
+	{"[Content_Types].xml", xml.Header + `<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">` +
+		`<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>` +
+		`<Default Extension="xml" ContentType="application/xml"/>` +
+		`<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>` +
+		`<Override PartName="/xl/worksheets/sheet1.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>` +
+		`</Types>`},
+	{"_rels/.rels", xml.Header + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+		`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>` +
+		`</Relationships>`},
+	{"xl/_rels/workbook.xml.rels", xml.Header + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+		`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/>` +
+		`</Relationships>`},
+}
+
+// Writer 写入 xlsx 文件，字符串使用 inline string 保存，不需要共享字符串表
+type Writer struct {
+	zw    *zip.Writer
+	sheet io.Writer
+	name  string
+	rows  int
+	err   error
+}
+
+// NewWriter 创建一个写入 w 的 Writer，工作表的名称为 sheet
+func NewWriter(w io.Writer, sheet string) *Writer {
+	x := &Writer{zw: zip.NewWriter(w), name: sheet}
+	for _, f := range files {
+		x.write(f.name, f.content)
+	}
+	x.write("xl/workbook.xml", xml.Header+`<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" `+
+		`xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">`+
+		`<sheets><sheet name="`+escape(sheet)+`" sheetId="1" r:id="rId1"/></sheets></workbook>`)
+	if x.err == nil {
+		x.sheet, x.err = x.zw.Create("xl/worksheets/sheet1.xml")
+	}
+	x.printf("%s<worksheet xmlns=\"http://schemas.openxmlformats.org/spreadsheetml/2006/main\"><sheetData>", xml.Header)
+	return x
+}
+
+// Write 写入一行，数字和布尔值保存为对应类型的单元格，其他的值保存为字符串
+func (x *Writer) Write(row []interface{}) error {
+	if x.err != nil {
+		return x.err
+	}
+
+	x.rows++
+	var b strings.Builder
+	fmt.Fprintf(&b, `<row r="%d">`, x.rows)
+	for i, value := range row {
+		ref := column(i) + strconv.Itoa(x.rows)
+		switch v := value.(type) {
+		case nil:
+		case int:
+			fmt.Fprintf(&b, `<c r="%s"><v>%d</v></c>`, ref, v)
+		case int64:
+			fmt.Fprintf(&b, `<c r="%s"><v>%d</v></c>`, ref, v)
+		case uint64:
+			fmt.Fprintf(&b, `<c r="%s"><v>%d</v></c>`, ref, v)
+		case float64:
+			fmt.Fprintf(&b, `<c r="%s"><v>%s</v></c>`, ref, strconv.FormatFloat(v, 'f', -1, 64))
+		case bool:
+			n := 0
+			if v {
+				n = 1
+			}
+			fmt.Fprintf(&b, `<c r="%s" t="b"><v>%d</v></c>`, ref, n)
+		default:
+			fmt.Fprintf(&b, `<c r="%s" t="inlineStr"><is><t xml:space="preserve">%s</t></is></c>`, ref, escape(fmt.Sprint(v)))
+		}
+	}
+	b.WriteString(`</row>`)
+	x.printf("%s", b.String())
+	return x.err
+}
+
+// Close 结束工作表并写入 zip 的目录，不会关闭底层的 io.Writer
+func (x *Writer) Close() error {
+	if x.err == ErrClosed {
+		return nil
+	}
+	x.printf("</sheetData></worksheet>")
+	if x.err == nil {
+		x.err = x.zw.Close()
+	}
+	if x.err != nil {
+		return x.err
+	}
+	x.err = ErrClosed
+	return nil
+}
+
+func (x *Writer) write(name, content string) {
+	if x.err != nil {
+		return
+	}
+	var w io.Writer
+	if w, x.err = x.zw.Create(name); x.err == nil {
+		_, x.err = io.WriteString(w, content)
+	}
+}
+
+func (x *Writer) printf(format string, v ...interface{}) {
+	if x.err != nil {
+		return
+	}
+	_, x.err = fmt.Fprintf(x.sheet, format, v...)
+}
+
+// column 返回第 i 列 (从 0 开始) 的列名，例如 A、Z、AA
+func column(i int) string {
+	name := ""
+	for i++; i > 0; i = (i - 1) / 26 {
+		name = string(rune('A'+(i-1)%26)) + name
+	}
+	return name
+}
+
+// escape 转义 XML 的特殊字符，并删除 XML 中不允许出现的控制字符
+func escape(s string) string {
+	s = strings.Map(func(r rune) rune {
+		if r < 0x20 && r != '\t' && r != '\n' && r != '\r' {
+			return -1
+		}
+		return r
+	}, s)
+	var b strings.Builder
+	_ = xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
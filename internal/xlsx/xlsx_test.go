@@ -0,0 +1,59 @@
+package xlsx
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"io/ioutil"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestColumn(t *testing.T) {
+	for i, name := range map[int]string{0: "A", 25: "Z", 26: "AA", 51: "AZ", 52: "BA", 701: "ZZ", 702: "AAA"} {
+		assert.Equal(t, name, column(i))
+	}
+}
+
+func TestWriter(t *testing.T) {
+	buf := bytes.NewBuffer(nil)
+	w := NewWriter(buf, "goods")
+	assert.NoError(t, w.Write([]interface{}{"uid", "price", "comments", "latest"}))
+	assert.NoError(t, w.Write([]interface{}{"<a & b>\x02", 14.99, 5, true}))
+	assert.NoError(t, w.Close())
+	assert.NoError(t, w.Close())
+	assert.Equal(t, ErrClosed, w.Write([]interface{}{"c"}))
+
+	r, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if !assert.NoError(t, err) {
+		return
+	}
+	files := map[string]string{}
+	for _, f := range r.File {
+		rc, err := f.Open()
+		if !assert.NoError(t, err) {
+			return
+		}
+		data, _ := ioutil.ReadAll(rc)
+		_ = rc.Close()
+		files[f.Name] = string(data)
+
+		// 每个文件都是合法的 XML
+		d := xml.NewDecoder(bytes.NewReader(data))
+		for {
+			if _, err = d.Token(); err != nil {
+				break
+			}
+		}
+		assert.Equal(t, "EOF", err.Error(), f.Name)
+	}
+
+	assert.Contains(t, files, "[Content_Types].xml")
+	assert.Contains(t, files["xl/workbook.xml"], `<sheet name="goods"`)
+	sheet := files["xl/worksheets/sheet1.xml"]
+	assert.Contains(t, sheet, `<c r="A2" t="inlineStr"><is><t xml:space="preserve">&lt;a &amp; b&gt;</t></is></c>`)
+	assert.Contains(t, sheet, `<c r="B2"><v>14.99</v></c>`)
+	assert.Contains(t, sheet, `<c r="C2"><v>5</v></c>`)
+	assert.Contains(t, sheet, `<c r="D2" t="b"><v>1</v></c>`)
+}
@@ -1,5 +1,7 @@
 @echo off
 
+rem cirrus.exe 需要使用 go build -tags sqlite_fts5 -o cirrus.exe ./cmd 编译
+
 call redis-server.exe
 
 cirrus.exe -config cirrus.toml
\ No newline at end of file
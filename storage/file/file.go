@@ -0,0 +1,502 @@
+package file
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/logger"
+
+	"github.com/lack-io/cirrus/config"
+	"github.com/lack-io/cirrus/storage"
+)
+
+const (
+	table = "urls"
+
+	// reapInterval 检查 in-flight url 租约的时间间隔
+	reapInterval = time.Second * 5
+
+	// snapshotBatch 导出快照时每次读取的记录数
+	snapshotBatch = 1000
+)
+
+// state url 的状态
+type state string
+
+const (
+	// raw 未被爬取过的 url
+	raw state = "raw"
+	// inflight 正在爬取的 url
+	inflight state = "inflight"
+	// dead 超过最大爬取次数的 url
+	dead state = "dead"
+	// cook 爬取过的 url
+	cook state = "cook"
+)
+
+// entry urls 表中的一条记录
+type entry struct {
+	ID uint64 `gorm:"column:id;primaryKey"`
+
+	// Namespace url 所属的命名空间
+	Namespace string `gorm:"column:namespace;default:default;uniqueIndex:idx_urls_namespace_path,priority:1;index:idx_urls_namespace_state_priority,priority:1"`
+
+	// Path url 路径
+	Path string `gorm:"column:path;uniqueIndex:idx_urls_namespace_path,priority:2"`
+
+	// State url 的状态
+	State state `gorm:"column:state;index:idx_urls_namespace_state_priority,priority:2;index:idx_urls_state_kind_fetched,priority:1"`
+
+	// Priority url 的优先级
+	Priority int `gorm:"column:priority;index:idx_urls_namespace_state_priority,priority:3"`
+
+	// Deadline in-flight 状态的 url 租约的到期时间
+	Deadline int64 `gorm:"column:deadline"`
+
+	// Attempts url 爬取失败的次数
+	Attempts int `gorm:"column:attempts"`
+
+	// LastError url 最后一次爬取失败的原因
+	LastError string `gorm:"column:last_error"`
+
+	// Kind url 的类型
+	Kind string `gorm:"column:kind;index:idx_urls_state_kind_fetched,priority:2"`
+
+	// Fetched url 最后一次爬取完成的时间
+	Fetched int64 `gorm:"column:fetched;index:idx_urls_state_kind_fetched,priority:3"`
+
+	// Depth url 的深度
+	Depth int `gorm:"column:depth"`
+
+	// Parent 发现 url 的页面路径
+	Parent string `gorm:"column:parent"`
+
+	// Discovered 第一次发现 url 的时间
+	Discovered int64 `gorm:"column:discovered"`
+}
+
+func (e *entry) url(s storage.Storage) *storage.URL {
+	return &storage.URL{
+		Path:       e.Path,
+		Priority:   e.Priority,
+		Attempts:   e.Attempts,
+		LastError:  e.LastError,
+		Kind:       e.Kind,
+		Fetched:    e.Fetched,
+		Depth:      e.Depth,
+		Parent:     e.Parent,
+		Discovered: e.Discovered,
+		Storage:    s,
+	}
+}
+
+// File 使用本地 sqlite 文件存储 url，进程重启后可以继续之前的爬取
+type File struct {
+	// ctx 控制 File 的停止
+	ctx context.Context
+
+	cfg *config.StorageFile
+
+	opts storage.Options
+
+	// ns 命名空间
+	ns string
+
+	db *gorm.DB
+
+	ready *atomic.Value
+}
+
+func NewFile(ctx context.Context, cfg *config.StorageFile, opts storage.Options) *File {
+	f := &File{
+		ctx:   ctx,
+		cfg:   cfg,
+		opts:  opts,
+		ns:    storage.DefaultNamespace,
+		ready: &atomic.Value{},
+	}
+
+	f.ready.Store(false)
+
+	return f
+}
+
+func (f *File) Init() error {
+	if f.cfg == nil || f.cfg.Name == "" {
+		return fmt.Errorf("%w: missing cfg file", storage.ErrStorage)
+	}
+
+	db, err := gorm.Open(sqlite.Open(f.cfg.Name), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		return err
+	}
+
+	DB, err := db.DB()
+	if err != nil {
+		return err
+	}
+	// sqlite 只支持单个写入者，串行化所有的操作
+	DB.SetMaxOpenConns(1)
+
+	err = db.Table(table).AutoMigrate(&entry{})
+	if err != nil {
+		return err
+	}
+
+	f.db = db
+	f.ready.Store(true)
+	go f.reap()
+	return nil
+}
+
+// Namespace 返回命名空间 ns 中的 File，和 f 共享同一个数据库连接，需要在 Init 之后调用
+func (f *File) Namespace(ns string) storage.Storage {
+	if !storage.ValidNamespace(ns) {
+		return storage.Invalid(f, ns)
+	}
+	n := *f
+	n.ns = ns
+	return &n
+}
+
+// scope 返回当前命名空间中的 urls 表
+func (f *File) scope(tx *gorm.DB) *gorm.DB {
+	return tx.Table(table).Where("namespace = ?", f.ns)
+}
+
+// reap 将所有命名空间中租约到期和需要重新爬取的 url 重新放回 raw
+func (f *File) reap() {
+	timer := time.NewTicker(reapInterval)
+	for {
+		select {
+		case <-f.ctx.Done():
+			timer.Stop()
+			f.ready.Store(false)
+			if DB, err := f.db.DB(); err == nil {
+				_ = DB.Close()
+			}
+			return
+		case now := <-timer.C:
+			_ = f.expire(now)
+		}
+	}
+}
+
+func (f *File) expire(now time.Time) error {
+	return f.db.Transaction(func(tx *gorm.DB) error {
+		entries := make([]*entry, 0)
+		err := tx.Table(table).
+			Where("state = ? AND deadline < ?", inflight, now.Unix()).
+			Find(&entries).Error
+		if err != nil {
+			return err
+		}
+
+		for _, e := range entries {
+			_, err = f.fail(tx, e, storage.ErrLeaseExpired)
+			if err != nil {
+				return err
+			}
+		}
+
+		for kind, ttl := range f.opts.Recrawl {
+			err = tx.Table(table).
+				Where("state = ? AND kind = ? AND fetched <= ?", cook, kind, now.Add(-ttl).Unix()).
+				Updates(map[string]interface{}{"state": raw, "attempts": 0, "last_error": ""}).Error
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// fail 记录 url 爬取失败，并将 url 放回 raw 或者死信队列，返回 url 是否进入了死信队列
+func (f *File) fail(tx *gorm.DB, e *entry, reason error) (bool, error) {
+	url := e.url(f)
+	isDead := f.opts.Fail(url, reason)
+
+	next := raw
+	if isDead {
+		next = dead
+	}
+	err := tx.Table(table).Where("id = ?", e.ID).Updates(map[string]interface{}{
+		"state":      next,
+		"attempts":   url.Attempts,
+		"last_error": url.LastError,
+	}).Error
+	if err != nil {
+		return false, err
+	}
+	return isDead, nil
+}
+
+func (f *File) Get() (*storage.URL, error) {
+	if !f.ready.Load().(bool) {
+		return nil, storage.ErrStorage
+	}
+
+	var url *storage.URL
+	err := f.db.Transaction(func(tx *gorm.DB) error {
+		entries := make([]*entry, 0)
+		err := f.scope(tx).Where("state = ?", raw).
+			Order("priority desc, id").Limit(1).Find(&entries).Error
+		if err != nil {
+			return err
+		}
+		if len(entries) == 0 {
+			return storage.ErrNoURL
+		}
+
+		err = tx.Table(table).Where("id = ?", entries[0].ID).Updates(map[string]interface{}{
+			"state":    inflight,
+			"deadline": time.Now().Add(f.opts.Lease).Unix(),
+		}).Error
+		if err != nil {
+			return err
+		}
+		url = entries[0].url(f)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return url, nil
+}
+
+func (f *File) Push(url storage.URL) error {
+	if !f.ready.Load().(bool) {
+		return storage.ErrStorage
+	}
+
+	return f.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Table(table).
+			Clauses(clause.OnConflict{Columns: []clause.Column{{Name: "namespace"}, {Name: "path"}}, DoNothing: true}).
+			Create(&entry{
+				Namespace:  f.ns,
+				Path:       url.Path,
+				State:      raw,
+				Priority:   url.Priority,
+				Kind:       url.Kind,
+				Depth:      url.Depth,
+				Parent:     url.Parent,
+				Discovered: url.Discovered,
+			})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected != 0 {
+			return nil
+		}
+
+		entries := make([]*entry, 0)
+		err := f.scope(tx).Where("path = ?", url.Path).Limit(1).Find(&entries).Error
+		if err != nil {
+			return err
+		}
+		if len(entries) == 0 {
+			return nil
+		}
+
+		switch entries[0].State {
+		case cook:
+			return storage.ErrOldURL
+		case dead:
+			return storage.ErrDeadURL
+		}
+		return nil
+	})
+}
+
+func (f *File) Persist(url storage.URL) error {
+	if !f.ready.Load().(bool) {
+		return storage.ErrStorage
+	}
+
+	// 已经存在的 url 保留发现时记录的信息
+	columns := []string{"state", "fetched", "attempts", "last_error"}
+	if url.Kind != "" {
+		columns = append(columns, "kind")
+	}
+	return f.db.Table(table).
+		Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "namespace"}, {Name: "path"}},
+			DoUpdates: clause.AssignmentColumns(columns),
+		}).
+		Create(&entry{
+			Namespace:  f.ns,
+			Path:       url.Path,
+			State:      cook,
+			Priority:   url.Priority,
+			Kind:       url.Kind,
+			Fetched:    time.Now().Unix(),
+			Depth:      url.Depth,
+			Parent:     url.Parent,
+			Discovered: url.Discovered,
+		}).Error
+}
+
+func (f *File) Nack(url storage.URL, reason error) error {
+	if !f.ready.Load().(bool) {
+		return storage.ErrStorage
+	}
+
+	var isDead bool
+	err := f.db.Transaction(func(tx *gorm.DB) error {
+		entries := make([]*entry, 0)
+		err := f.scope(tx).
+			Where("path = ? AND state = ?", url.Path, inflight).
+			Limit(1).Find(&entries).Error
+		if err != nil {
+			return err
+		}
+		if len(entries) == 0 {
+			return nil
+		}
+		isDead, err = f.fail(tx, entries[0], reason)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if isDead {
+		return storage.ErrDeadURL
+	}
+	return nil
+}
+
+func (f *File) Lookup(path string) (*storage.URL, error) {
+	if !f.ready.Load().(bool) {
+		return nil, storage.ErrStorage
+	}
+
+	entries := make([]*entry, 0)
+	err := f.scope(f.db).Where("path = ?", path).Limit(1).Find(&entries).Error
+	if err != nil {
+		return nil, err
+	}
+	if len(entries) == 0 {
+		return nil, storage.ErrNoURL
+	}
+	return entries[0].url(f), nil
+}
+
+func (f *File) Dead() ([]*storage.URL, error) {
+	if !f.ready.Load().(bool) {
+		return nil, storage.ErrStorage
+	}
+
+	entries := make([]*entry, 0)
+	err := f.scope(f.db).Where("state = ?", dead).Order("path").Find(&entries).Error
+	if err != nil {
+		return nil, err
+	}
+
+	urls := make([]*storage.URL, 0, len(entries))
+	for _, e := range entries {
+		urls = append(urls, e.url(f))
+	}
+	return urls, nil
+}
+
+func (f *File) Requeue(path string) error {
+	if !f.ready.Load().(bool) {
+		return storage.ErrStorage
+	}
+
+	result := f.scope(f.db).
+		Where("path = ? AND state = ?", path, dead).
+		Updates(map[string]interface{}{"state": raw, "attempts": 0})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("%w: %s", storage.ErrNoURL, path)
+	}
+	return nil
+}
+
+func (f *File) Snapshot(fn func(*storage.Record) error) error {
+	if !f.ready.Load().(bool) {
+		return storage.ErrStorage
+	}
+
+	// 按照 id 分批读取，保持 url 入队的顺序
+	var last uint64
+	for {
+		entries := make([]*entry, 0, snapshotBatch)
+		err := f.scope(f.db).Where("id > ?", last).Order("id").Limit(snapshotBatch).Find(&entries).Error
+		if err != nil {
+			return err
+		}
+		for _, e := range entries {
+			r := &storage.Record{URL: *e.url(nil), State: storage.State(e.State)}
+			if e.State == inflight {
+				r.Deadline = e.Deadline
+			}
+			if err = fn(r); err != nil {
+				return err
+			}
+		}
+		if len(entries) < snapshotBatch {
+			return nil
+		}
+		last = entries[len(entries)-1].ID
+	}
+}
+
+func (f *File) Restore(r *storage.Record) error {
+	if !f.ready.Load().(bool) {
+		return storage.ErrStorage
+	}
+
+	next, fetched := state(r.State), r.Fetched
+	switch r.State {
+	case storage.StateRaw, storage.StateInflight:
+		next = raw
+	case storage.StateCook:
+		if fetched == 0 {
+			fetched = time.Now().Unix()
+		}
+	case storage.StateDead:
+	default:
+		// File 不使用布隆过滤器，无法导入 bitmap
+		return fmt.Errorf("%w: unsupported state %q", storage.ErrSnapshot, r.State)
+	}
+
+	return f.db.Table(table).
+		Clauses(clause.OnConflict{
+			Columns: []clause.Column{{Name: "namespace"}, {Name: "path"}},
+			DoUpdates: clause.AssignmentColumns([]string{
+				"state", "priority", "deadline", "attempts", "last_error", "kind", "fetched", "depth", "parent", "discovered",
+			}),
+		}).
+		Create(&entry{
+			Namespace:  f.ns,
+			Path:       r.Path,
+			State:      next,
+			Priority:   r.Priority,
+			Attempts:   r.Attempts,
+			LastError:  r.LastError,
+			Kind:       r.Kind,
+			Fetched:    fetched,
+			Depth:      r.Depth,
+			Parent:     r.Parent,
+			Discovered: r.Discovered,
+		}).Error
+}
+
+func (f *File) Reset() {
+	if f.db == nil {
+		return
+	}
+	f.scope(f.db).Delete(&entry{})
+}
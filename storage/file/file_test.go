@@ -0,0 +1,342 @@
+package file
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/lack-io/cirrus/config"
+	"github.com/lack-io/cirrus/storage"
+	"github.com/lack-io/cirrus/storage/storagetest"
+)
+
+func newFile(t *testing.T, ctx context.Context, name string) *File {
+	f := NewFile(ctx, &config.StorageFile{Name: name}, storage.Options{Lease: time.Minute, MaxAttempts: 2})
+	if err := f.Init(); err != nil {
+		t.Fatal(err)
+	}
+	return f
+}
+
+func TestFile_Init(t *testing.T) {
+	f := NewFile(context.Background(), &config.StorageFile{}, storage.Options{})
+	assert.Error(t, f.Init())
+
+	_, err := f.Get()
+	assert.Equal(t, storage.ErrStorage, err)
+}
+
+func TestFile_Get(t *testing.T) {
+	f := newFile(t, context.Background(), filepath.Join(t.TempDir(), "storage.db"))
+
+	_, err := f.Get()
+	assert.Equal(t, storage.ErrNoURL, err)
+
+	url := storage.URL{Path: "https://www.cdiscount.com"}
+	assert.NoError(t, f.Push(url))
+	assert.NoError(t, f.Push(url))
+
+	u, err := f.Get()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, url.Path, u.Path)
+
+	_, err = f.Get()
+	assert.Equal(t, storage.ErrNoURL, err)
+}
+
+func TestFile_Persist(t *testing.T) {
+	f := newFile(t, context.Background(), filepath.Join(t.TempDir(), "storage.db"))
+
+	url := storage.URL{Path: "https://www.cdiscount.com"}
+	assert.NoError(t, f.Push(url))
+	assert.NoError(t, f.Persist(url))
+	assert.Equal(t, storage.ErrOldURL, f.Push(url))
+
+	_, err := f.Get()
+	assert.Equal(t, storage.ErrNoURL, err)
+}
+
+func TestFile_Restart(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "storage.db")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	f := newFile(t, ctx, name)
+	assert.NoError(t, f.Push(storage.URL{Path: "https://www.cdiscount.com/f-1.html"}))
+	assert.NoError(t, f.Persist(storage.URL{Path: "https://www.cdiscount.com"}))
+	cancel()
+
+	f = newFile(t, context.Background(), name)
+	assert.Equal(t, storage.ErrOldURL, f.Push(storage.URL{Path: "https://www.cdiscount.com"}))
+
+	u, err := f.Get()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "https://www.cdiscount.com/f-1.html", u.Path)
+}
+
+func TestFile_Nack(t *testing.T) {
+	f := newFile(t, context.Background(), filepath.Join(t.TempDir(), "storage.db"))
+
+	url := storage.URL{Path: "https://www.cdiscount.com"}
+	assert.NoError(t, f.Push(url))
+
+	u, err := f.Get()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// in-flight 状态的 url 不会被重复添加
+	assert.NoError(t, f.Push(url))
+	_, err = f.Get()
+	assert.Equal(t, storage.ErrNoURL, err)
+
+	assert.NoError(t, f.Nack(*u, errors.New("timeout")))
+	u, err = f.Get()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, url.Path, u.Path)
+}
+
+func TestFile_Expire(t *testing.T) {
+	f := newFile(t, context.Background(), filepath.Join(t.TempDir(), "storage.db"))
+
+	url := storage.URL{Path: "https://www.cdiscount.com"}
+	assert.NoError(t, f.Push(url))
+	_, err := f.Get()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.NoError(t, f.expire(time.Now()))
+	_, err = f.Get()
+	assert.Equal(t, storage.ErrNoURL, err)
+
+	assert.NoError(t, f.expire(time.Now().Add(time.Minute*2)))
+	u, err := f.Get()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, url.Path, u.Path)
+}
+
+func TestFile_Reset(t *testing.T) {
+	f := newFile(t, context.Background(), filepath.Join(t.TempDir(), "storage.db"))
+
+	url := storage.URL{Path: "https://www.cdiscount.com"}
+	assert.NoError(t, f.Persist(url))
+	assert.NoError(t, f.Push(storage.URL{Path: "https://www.cdiscount.com/f-1.html"}))
+
+	f.Reset()
+
+	_, err := f.Get()
+	assert.Equal(t, storage.ErrNoURL, err)
+	assert.NoError(t, f.Push(url))
+}
+
+func TestFile_Priority(t *testing.T) {
+	f := newFile(t, context.Background(), filepath.Join(t.TempDir(), "storage.db"))
+
+	assert.NoError(t, f.Push(storage.URL{Path: "https://www.cdiscount.com/a.html"}))
+	assert.NoError(t, f.Push(storage.URL{Path: "https://www.cdiscount.com/f-1.html", Priority: 10}))
+	assert.NoError(t, f.Push(storage.URL{Path: "https://www.cdiscount.com/b.html"}))
+	assert.NoError(t, f.Push(storage.URL{Path: "https://www.cdiscount.com/f-2.html", Priority: 10}))
+
+	expect := []string{
+		"https://www.cdiscount.com/f-1.html",
+		"https://www.cdiscount.com/f-2.html",
+		"https://www.cdiscount.com/a.html",
+		"https://www.cdiscount.com/b.html",
+	}
+	for _, path := range expect {
+		u, err := f.Get()
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, path, u.Path)
+	}
+}
+
+func TestFile_Dead(t *testing.T) {
+	f := newFile(t, context.Background(), filepath.Join(t.TempDir(), "storage.db"))
+
+	url := storage.URL{Path: "https://www.cdiscount.com", Priority: 10}
+	assert.NoError(t, f.Push(url))
+
+	u, err := f.Get()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.NoError(t, f.Nack(*u, errors.New("timeout")))
+
+	u, err = f.Get()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, 1, u.Attempts)
+	assert.Equal(t, "timeout", u.LastError)
+	assert.Equal(t, storage.ErrDeadURL, f.Nack(*u, errors.New("refused")))
+
+	_, err = f.Get()
+	assert.Equal(t, storage.ErrNoURL, err)
+	assert.Equal(t, storage.ErrDeadURL, f.Push(url))
+
+	dead, err := f.Dead()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if assert.Len(t, dead, 1) {
+		assert.Equal(t, url.Path, dead[0].Path)
+		assert.Equal(t, 2, dead[0].Attempts)
+		assert.Equal(t, "refused", dead[0].LastError)
+	}
+
+	assert.True(t, errors.Is(f.Requeue("https://www.cdiscount.com/f-1.html"), storage.ErrNoURL))
+	assert.NoError(t, f.Requeue(url.Path))
+	u, err = f.Get()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, url.Path, u.Path)
+	assert.Equal(t, 10, u.Priority)
+	assert.Equal(t, 0, u.Attempts)
+}
+
+func TestFile_Namespace(t *testing.T) {
+	f := newFile(t, context.Background(), filepath.Join(t.TempDir(), "storage.db"))
+	a, b := f.Namespace("a"), f.Namespace("b")
+
+	url := storage.URL{Path: "https://www.cdiscount.com"}
+	assert.NoError(t, a.Persist(url))
+	assert.Equal(t, storage.ErrOldURL, a.Push(url))
+	assert.NoError(t, b.Push(url))
+
+	a.Reset()
+	assert.NoError(t, a.Push(url))
+
+	u, err := b.Get()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, url.Path, u.Path)
+	assert.NoError(t, u.Storage.Persist(*u))
+	assert.Equal(t, storage.ErrOldURL, b.Push(url))
+
+	_, err = f.Get()
+	assert.Equal(t, storage.ErrNoURL, err)
+}
+
+func TestFile_Snapshot(t *testing.T) {
+	f := newFile(t, context.Background(), filepath.Join(t.TempDir(), "storage.db"))
+	assert.NoError(t, f.Push(storage.URL{Path: "https://www.cdiscount.com/a.html"}))
+	assert.NoError(t, f.Push(storage.URL{Path: "https://www.cdiscount.com/f-1.html", Priority: 10}))
+	assert.NoError(t, f.Persist(storage.URL{Path: "https://www.cdiscount.com"}))
+	u, _ := f.Get()
+	assert.Equal(t, "https://www.cdiscount.com/f-1.html", u.Path)
+
+	records := make([]*storage.Record, 0)
+	err := f.Snapshot(func(r *storage.Record) error {
+		records = append(records, r)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if assert.Equal(t, 3, len(records)) {
+		assert.Equal(t, storage.StateRaw, records[0].State)
+		assert.Equal(t, storage.StateInflight, records[1].State)
+		assert.NotZero(t, records[1].Deadline)
+		assert.Equal(t, storage.StateCook, records[2].State)
+	}
+
+	g := f.Namespace("copy")
+	for _, r := range records {
+		assert.NoError(t, g.Restore(r))
+	}
+	assert.Error(t, g.Restore(&storage.Record{State: storage.StateVisited}))
+	assert.Equal(t, storage.ErrOldURL, g.Push(storage.URL{Path: "https://www.cdiscount.com"}))
+	u, _ = g.Get()
+	assert.Equal(t, "https://www.cdiscount.com/f-1.html", u.Path)
+	assert.Equal(t, 10, u.Priority)
+
+	// 导入会覆盖已经存在的 url
+	assert.NoError(t, g.Restore(&storage.Record{URL: storage.URL{Path: "https://www.cdiscount.com"}, State: storage.StateRaw}))
+	u, _ = g.Get()
+	assert.Equal(t, "https://www.cdiscount.com/a.html", u.Path)
+	u, _ = g.Get()
+	assert.Equal(t, "https://www.cdiscount.com", u.Path)
+}
+
+func TestFile_Recrawl(t *testing.T) {
+	f := NewFile(context.Background(), &config.StorageFile{Name: filepath.Join(t.TempDir(), "storage.db")}, storage.Options{
+		Lease:   time.Minute,
+		Recrawl: map[string]time.Duration{"link": time.Hour},
+	})
+	if err := f.Init(); err != nil {
+		t.Fatal(err)
+	}
+
+	assert.NoError(t, f.Push(storage.URL{Path: "https://www.cdiscount.com", Kind: "group"}))
+	assert.NoError(t, f.Push(storage.URL{Path: "https://www.cdiscount.com/f-1.html", Priority: 10, Kind: "link"}))
+	for i := 0; i < 2; i++ {
+		u, err := f.Get()
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.NoError(t, f.Persist(*u))
+	}
+
+	assert.NoError(t, f.expire(time.Now().Add(time.Minute)))
+	_, err := f.Get()
+	assert.Equal(t, storage.ErrNoURL, err)
+
+	// 只有配置了重新爬取间隔的 url 会被重新放回 raw
+	assert.NoError(t, f.expire(time.Now().Add(time.Hour)))
+	u, err := f.Get()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "https://www.cdiscount.com/f-1.html", u.Path)
+	assert.Equal(t, "link", u.Kind)
+	assert.NotZero(t, u.Fetched)
+	_, err = f.Get()
+	assert.Equal(t, storage.ErrNoURL, err)
+}
+
+func TestFile_Lookup(t *testing.T) {
+	f := newFile(t, context.Background(), filepath.Join(t.TempDir(), "storage.db"))
+
+	url := storage.URL{Path: "https://www.cdiscount.com/f-1.html", Depth: 1, Parent: "https://www.cdiscount.com", Discovered: 100}
+	_, err := f.Lookup(url.Path)
+	assert.Equal(t, storage.ErrNoURL, err)
+
+	assert.NoError(t, f.Push(url))
+	u, _ := f.Get()
+	assert.Equal(t, 1, u.Depth)
+	assert.Equal(t, url.Parent, u.Parent)
+
+	// Persist 不会覆盖发现 url 时记录的信息
+	assert.NoError(t, f.Persist(storage.URL{Path: url.Path}))
+	u, err = f.Lookup(url.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, url.Parent, u.Parent)
+	assert.Equal(t, int64(100), u.Discovered)
+	assert.NotZero(t, u.Fetched)
+}
+
+func TestFile_Conformance(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T, opts storage.Options) storage.Storage {
+		ctx, cancel := context.WithCancel(context.Background())
+		t.Cleanup(cancel)
+		return NewFile(ctx, &config.StorageFile{Name: filepath.Join(t.TempDir(), "storage.db")}, opts)
+	})
+}
@@ -0,0 +1,393 @@
+package memory
+
+import (
+	"container/heap"
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/lack-io/cirrus/storage"
+)
+
+const (
+	// reapInterval 检查 in-flight url 租约的时间间隔
+	reapInterval = time.Second * 5
+)
+
+// lease in-flight 状态的 url
+type lease struct {
+	url storage.URL
+
+	// deadline 租约的到期时间
+	deadline time.Time
+}
+
+// space 一个命名空间中的 url
+type space struct {
+	// raw 存储未被爬取过的 url，按照优先级排序
+	raw *queue
+
+	// inflight 存储正在爬取的 url
+	inflight map[string]*lease
+
+	// dead 存储超过最大爬取次数的 url
+	dead map[string]storage.URL
+
+	// cook 存储爬取过的 url
+	cook map[string]storage.URL
+
+	// recrawl 存储需要重新爬取的 url，按照重新爬取的时间排序，避免每次检查时遍历 cook
+	recrawl *schedule
+}
+
+func newSpace() *space {
+	return &space{
+		raw:      newQueue(),
+		inflight: map[string]*lease{},
+		dead:     map[string]storage.URL{},
+		cook:     map[string]storage.URL{},
+		recrawl:  &schedule{},
+	}
+}
+
+// Memory 进程内的 url 存储，数据不会持久化，适用于单机爬取和测试
+type Memory struct {
+	// ctx 控制 Memory 的停止
+	ctx context.Context
+
+	opts storage.Options
+
+	// ns 命名空间
+	ns string
+
+	// lock spaces 的互斥锁，所有命名空间共享
+	lock *sync.Mutex
+
+	// spaces 所有命名空间中的 url，所有命名空间共享
+	spaces map[string]*space
+
+	ready *atomic.Value
+}
+
+func NewMemory(ctx context.Context, opts storage.Options) *Memory {
+	m := &Memory{
+		ctx:    ctx,
+		opts:   opts,
+		ns:     storage.DefaultNamespace,
+		lock:   &sync.Mutex{},
+		spaces: map[string]*space{},
+		ready:  &atomic.Value{},
+	}
+
+	m.ready.Store(false)
+
+	return m
+}
+
+func (m *Memory) Init() error {
+	m.ready.Store(true)
+	go m.reap()
+	return nil
+}
+
+func (m *Memory) Namespace(ns string) storage.Storage {
+	if !storage.ValidNamespace(ns) {
+		return storage.Invalid(m, ns)
+	}
+	n := *m
+	n.ns = ns
+	return &n
+}
+
+// space 返回当前命名空间中的 url，调用前需要持有 lock
+func (m *Memory) space() *space {
+	s, ok := m.spaces[m.ns]
+	if !ok {
+		s = newSpace()
+		m.spaces[m.ns] = s
+	}
+	return s
+}
+
+// reap 将所有命名空间中租约到期和需要重新爬取的 url 重新放回 raw
+func (m *Memory) reap() {
+	timer := time.NewTicker(reapInterval)
+	for {
+		select {
+		case <-m.ctx.Done():
+			timer.Stop()
+			m.ready.Store(false)
+			return
+		case now := <-timer.C:
+			m.expire(now)
+		}
+	}
+}
+
+func (m *Memory) expire(now time.Time) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	for _, s := range m.spaces {
+		for path, l := range s.inflight {
+			if now.After(l.deadline) {
+				delete(s.inflight, path)
+				_ = m.fail(s, l.url, storage.ErrLeaseExpired)
+			}
+		}
+		for {
+			d, ok := s.recrawl.next(now)
+			if !ok {
+				break
+			}
+			// 过期的记录：url 已经被重新放回 raw，或者之后又被爬取过
+			url, found := s.cook[d.path]
+			if at, scheduled := m.opts.Due(url); !found || !scheduled || !at.Equal(d.at) {
+				continue
+			}
+			delete(s.cook, d.path)
+			s.raw.add(url)
+		}
+	}
+}
+
+// cook 将 url 保存到 cook 中，配置了重新爬取间隔的 url 同时加入 recrawl
+func (m *Memory) cook(s *space, url storage.URL) {
+	s.cook[url.Path] = url
+	if at, ok := m.opts.Due(url); ok {
+		heap.Push(s.recrawl, due{path: url.Path, at: at})
+	}
+}
+
+// fail 记录 url 爬取失败，并将 url 放回 raw 或者死信队列
+func (m *Memory) fail(s *space, url storage.URL, reason error) error {
+	if m.opts.Fail(&url, reason) {
+		s.dead[url.Path] = url
+		return storage.ErrDeadURL
+	}
+	s.raw.add(url)
+	return nil
+}
+
+func (m *Memory) Get() (*storage.URL, error) {
+	if !m.ready.Load().(bool) {
+		return nil, storage.ErrStorage
+	}
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	s := m.space()
+	it, ok := s.raw.pop()
+	if !ok {
+		return nil, storage.ErrNoURL
+	}
+
+	s.inflight[it.url.Path] = &lease{url: it.url, deadline: time.Now().Add(m.opts.Lease)}
+
+	url := it.url
+	url.Storage = m
+	return &url, nil
+}
+
+func (m *Memory) Push(url storage.URL) error {
+	if !m.ready.Load().(bool) {
+		return storage.ErrStorage
+	}
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	s := m.space()
+	if _, ok := s.cook[url.Path]; ok {
+		return storage.ErrOldURL
+	}
+	if _, ok := s.dead[url.Path]; ok {
+		return storage.ErrDeadURL
+	}
+	if _, ok := s.inflight[url.Path]; ok {
+		return nil
+	}
+
+	url.Storage = nil
+	s.raw.add(url)
+	return nil
+}
+
+func (m *Memory) Persist(url storage.URL) error {
+	if !m.ready.Load().(bool) {
+		return storage.ErrStorage
+	}
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	s := m.space()
+	delete(s.inflight, url.Path)
+	url.Storage = nil
+	url.Attempts, url.LastError = 0, ""
+	url.Fetched = time.Now().Unix()
+	m.cook(s, url)
+	return nil
+}
+
+func (m *Memory) Nack(url storage.URL, reason error) error {
+	if !m.ready.Load().(bool) {
+		return storage.ErrStorage
+	}
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	s := m.space()
+	l, ok := s.inflight[url.Path]
+	if !ok {
+		return nil
+	}
+	delete(s.inflight, url.Path)
+	return m.fail(s, l.url, reason)
+}
+
+func (m *Memory) Lookup(path string) (*storage.URL, error) {
+	if !m.ready.Load().(bool) {
+		return nil, storage.ErrStorage
+	}
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	s := m.space()
+	url, ok := s.raw.get(path)
+	if !ok {
+		if l, found := s.inflight[path]; found {
+			url, ok = l.url, true
+		}
+	}
+	if !ok {
+		url, ok = s.dead[path]
+	}
+	if !ok {
+		url, ok = s.cook[path]
+	}
+	if !ok {
+		return nil, storage.ErrNoURL
+	}
+
+	url.Storage = m
+	return &url, nil
+}
+
+func (m *Memory) Dead() ([]*storage.URL, error) {
+	if !m.ready.Load().(bool) {
+		return nil, storage.ErrStorage
+	}
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	s := m.space()
+	urls := make([]*storage.URL, 0, len(s.dead))
+	for _, url := range s.dead {
+		u := url
+		u.Storage = m
+		urls = append(urls, &u)
+	}
+	sort.Slice(urls, func(i, j int) bool { return urls[i].Path < urls[j].Path })
+	return urls, nil
+}
+
+func (m *Memory) Requeue(path string) error {
+	if !m.ready.Load().(bool) {
+		return storage.ErrStorage
+	}
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	s := m.space()
+	url, ok := s.dead[path]
+	if !ok {
+		return fmt.Errorf("%w: %s", storage.ErrNoURL, path)
+	}
+	delete(s.dead, path)
+	url.Attempts = 0
+	s.raw.add(url)
+	return nil
+}
+
+func (m *Memory) Snapshot(fn func(*storage.Record) error) error {
+	if !m.ready.Load().(bool) {
+		return storage.ErrStorage
+	}
+
+	// 复制当前命名空间中的记录，避免在 fn 中持有锁
+	m.lock.Lock()
+	s := m.space()
+	records := make([]*storage.Record, 0, s.raw.Len()+len(s.inflight)+len(s.dead)+len(s.cook))
+	for _, url := range s.raw.urls() {
+		records = append(records, &storage.Record{URL: url, State: storage.StateRaw})
+	}
+	for _, l := range s.inflight {
+		records = append(records, &storage.Record{URL: l.url, State: storage.StateInflight, Deadline: l.deadline.Unix()})
+	}
+	for _, url := range s.dead {
+		records = append(records, &storage.Record{URL: url, State: storage.StateDead})
+	}
+	for _, url := range s.cook {
+		records = append(records, &storage.Record{URL: url, State: storage.StateCook})
+	}
+	m.lock.Unlock()
+
+	for _, r := range records {
+		if err := fn(r); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *Memory) Restore(r *storage.Record) error {
+	if !m.ready.Load().(bool) {
+		return storage.ErrStorage
+	}
+
+	// Memory 不使用布隆过滤器，无法导入 bitmap
+	if r.State == storage.StateVisited {
+		return fmt.Errorf("%w: unsupported state %q", storage.ErrSnapshot, r.State)
+	}
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	s := m.space()
+	url := r.URL
+	url.Storage = nil
+
+	s.raw.remove(url.Path)
+	delete(s.inflight, url.Path)
+	delete(s.dead, url.Path)
+	delete(s.cook, url.Path)
+
+	switch r.State {
+	case storage.StateRaw, storage.StateInflight:
+		s.raw.add(url)
+	case storage.StateDead:
+		s.dead[url.Path] = url
+	case storage.StateCook:
+		if url.Fetched == 0 {
+			url.Fetched = time.Now().Unix()
+		}
+		m.cook(s, url)
+	}
+	return nil
+}
+
+func (m *Memory) Reset() {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	delete(m.spaces, m.ns)
+}
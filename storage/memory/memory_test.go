@@ -0,0 +1,336 @@
+package memory
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/lack-io/cirrus/storage"
+	"github.com/lack-io/cirrus/storage/storagetest"
+)
+
+func newMemory(t *testing.T) *Memory {
+	m := NewMemory(context.Background(), storage.Options{Lease: time.Minute, MaxAttempts: 2})
+	if err := m.Init(); err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+func TestMemory_NotReady(t *testing.T) {
+	m := NewMemory(context.Background(), storage.Options{Lease: time.Minute})
+
+	_, err := m.Get()
+	assert.Equal(t, storage.ErrStorage, err)
+	assert.Equal(t, storage.ErrStorage, m.Push(storage.URL{Path: "https://www.cdiscount.com"}))
+	assert.Equal(t, storage.ErrStorage, m.Persist(storage.URL{Path: "https://www.cdiscount.com"}))
+}
+
+func TestMemory_Get(t *testing.T) {
+	m := newMemory(t)
+
+	_, err := m.Get()
+	assert.Equal(t, storage.ErrNoURL, err)
+
+	url := storage.URL{Path: "https://www.cdiscount.com"}
+	assert.NoError(t, m.Push(url))
+	assert.NoError(t, m.Push(url))
+
+	u, err := m.Get()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, url.Path, u.Path)
+
+	_, err = m.Get()
+	assert.Equal(t, storage.ErrNoURL, err)
+}
+
+func TestMemory_Persist(t *testing.T) {
+	m := newMemory(t)
+
+	url := storage.URL{Path: "https://www.cdiscount.com"}
+	assert.NoError(t, m.Persist(url))
+	assert.Equal(t, storage.ErrOldURL, m.Push(url))
+}
+
+func TestMemory_Reset(t *testing.T) {
+	m := newMemory(t)
+
+	url := storage.URL{Path: "https://www.cdiscount.com"}
+	assert.NoError(t, m.Persist(url))
+	assert.NoError(t, m.Push(storage.URL{Path: "https://www.cdiscount.com/f-1.html"}))
+
+	m.Reset()
+
+	_, err := m.Get()
+	assert.Equal(t, storage.ErrNoURL, err)
+	assert.NoError(t, m.Push(url))
+}
+
+func TestMemory_Priority(t *testing.T) {
+	m := newMemory(t)
+
+	assert.NoError(t, m.Push(storage.URL{Path: "https://www.cdiscount.com/a.html"}))
+	assert.NoError(t, m.Push(storage.URL{Path: "https://www.cdiscount.com/f-1.html", Priority: 10}))
+	assert.NoError(t, m.Push(storage.URL{Path: "https://www.cdiscount.com/b.html"}))
+	assert.NoError(t, m.Push(storage.URL{Path: "https://www.cdiscount.com/f-2.html", Priority: 10}))
+
+	expect := []string{
+		"https://www.cdiscount.com/f-1.html",
+		"https://www.cdiscount.com/f-2.html",
+		"https://www.cdiscount.com/a.html",
+		"https://www.cdiscount.com/b.html",
+	}
+	for _, path := range expect {
+		u, err := m.Get()
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, path, u.Path)
+	}
+}
+
+func TestMemory_Nack(t *testing.T) {
+	m := newMemory(t)
+
+	url := storage.URL{Path: "https://www.cdiscount.com"}
+	assert.NoError(t, m.Push(url))
+
+	u, err := m.Get()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// in-flight 状态的 url 不会被重复添加
+	assert.NoError(t, m.Push(url))
+	_, err = m.Get()
+	assert.Equal(t, storage.ErrNoURL, err)
+
+	assert.NoError(t, m.Nack(*u, errors.New("timeout")))
+	u, err = m.Get()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, url.Path, u.Path)
+}
+
+func TestMemory_Expire(t *testing.T) {
+	m := newMemory(t)
+
+	url := storage.URL{Path: "https://www.cdiscount.com"}
+	assert.NoError(t, m.Push(url))
+	_, err := m.Get()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m.expire(time.Now())
+	_, err = m.Get()
+	assert.Equal(t, storage.ErrNoURL, err)
+
+	m.expire(time.Now().Add(time.Minute * 2))
+	u, err := m.Get()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, url.Path, u.Path)
+}
+
+func TestMemory_Dead(t *testing.T) {
+	m := newMemory(t)
+
+	url := storage.URL{Path: "https://www.cdiscount.com", Priority: 10}
+	assert.NoError(t, m.Push(url))
+
+	u, err := m.Get()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.NoError(t, m.Nack(*u, errors.New("timeout")))
+
+	u, err = m.Get()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, 1, u.Attempts)
+	assert.Equal(t, "timeout", u.LastError)
+	assert.Equal(t, storage.ErrDeadURL, m.Nack(*u, errors.New("refused")))
+
+	_, err = m.Get()
+	assert.Equal(t, storage.ErrNoURL, err)
+	assert.Equal(t, storage.ErrDeadURL, m.Push(url))
+
+	dead, err := m.Dead()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if assert.Len(t, dead, 1) {
+		assert.Equal(t, url.Path, dead[0].Path)
+		assert.Equal(t, 2, dead[0].Attempts)
+		assert.Equal(t, "refused", dead[0].LastError)
+	}
+
+	assert.True(t, errors.Is(m.Requeue("https://www.cdiscount.com/f-1.html"), storage.ErrNoURL))
+	assert.NoError(t, m.Requeue(url.Path))
+	u, err = m.Get()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, url.Path, u.Path)
+	assert.Equal(t, 10, u.Priority)
+	assert.Equal(t, 0, u.Attempts)
+}
+
+func TestMemory_Namespace(t *testing.T) {
+	m := newMemory(t)
+	a, b := m.Namespace("a"), m.Namespace("b")
+
+	url := storage.URL{Path: "https://www.cdiscount.com"}
+	assert.NoError(t, a.Persist(url))
+	assert.Equal(t, storage.ErrOldURL, a.Push(url))
+	assert.NoError(t, b.Push(url))
+
+	a.Reset()
+	assert.NoError(t, a.Push(url))
+
+	u, err := b.Get()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, url.Path, u.Path)
+	assert.NoError(t, u.Storage.Persist(*u))
+	assert.Equal(t, storage.ErrOldURL, b.Push(url))
+
+	_, err = m.Get()
+	assert.Equal(t, storage.ErrNoURL, err)
+}
+
+func TestMemory_Snapshot(t *testing.T) {
+	m := newMemory(t)
+	assert.NoError(t, m.Push(storage.URL{Path: "https://www.cdiscount.com/a.html"}))
+	assert.NoError(t, m.Push(storage.URL{Path: "https://www.cdiscount.com/b.html"}))
+	assert.NoError(t, m.Persist(storage.URL{Path: "https://www.cdiscount.com"}))
+
+	paths := make([]string, 0)
+	err := m.Snapshot(func(r *storage.Record) error {
+		paths = append(paths, string(r.State)+" "+r.Path)
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		"raw https://www.cdiscount.com/a.html",
+		"raw https://www.cdiscount.com/b.html",
+		"cook https://www.cdiscount.com",
+	}, paths)
+
+	// 导入会覆盖已经存在的 url
+	assert.NoError(t, m.Restore(&storage.Record{URL: storage.URL{Path: "https://www.cdiscount.com/a.html"}, State: storage.StateCook}))
+	assert.NoError(t, m.Restore(&storage.Record{URL: storage.URL{Path: "https://www.cdiscount.com"}, State: storage.StateRaw}))
+
+	u, _ := m.Get()
+	assert.Equal(t, "https://www.cdiscount.com/b.html", u.Path)
+	u, _ = m.Get()
+	assert.Equal(t, "https://www.cdiscount.com", u.Path)
+	_, err = m.Get()
+	assert.Equal(t, storage.ErrNoURL, err)
+}
+
+func TestMemory_Recrawl(t *testing.T) {
+	m := NewMemory(context.Background(), storage.Options{
+		Lease:   time.Minute,
+		Recrawl: map[string]time.Duration{"link": time.Hour},
+	})
+	if err := m.Init(); err != nil {
+		t.Fatal(err)
+	}
+
+	assert.NoError(t, m.Push(storage.URL{Path: "https://www.cdiscount.com", Kind: "group"}))
+	assert.NoError(t, m.Push(storage.URL{Path: "https://www.cdiscount.com/f-1.html", Priority: 10, Kind: "link"}))
+	for i := 0; i < 2; i++ {
+		u, err := m.Get()
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.NoError(t, m.Persist(*u))
+	}
+
+	m.expire(time.Now().Add(time.Minute))
+	_, err := m.Get()
+	assert.Equal(t, storage.ErrNoURL, err)
+
+	// 只有配置了重新爬取间隔的 url 会被重新放回 raw
+	m.expire(time.Now().Add(time.Hour))
+	u, err := m.Get()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "https://www.cdiscount.com/f-1.html", u.Path)
+	assert.Equal(t, 10, u.Priority)
+	_, err = m.Get()
+	assert.Equal(t, storage.ErrNoURL, err)
+}
+
+func TestMemory_RecrawlRescheduled(t *testing.T) {
+	m := NewMemory(context.Background(), storage.Options{
+		Lease:   time.Minute,
+		Recrawl: map[string]time.Duration{"link": time.Hour},
+	})
+	if err := m.Init(); err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	url := storage.URL{Path: "https://www.cdiscount.com/f-1.html", Kind: "link", Fetched: now.Add(-time.Hour * 2).Unix()}
+	assert.NoError(t, m.Restore(&storage.Record{URL: url, State: storage.StateCook}))
+	// 再次爬取后之前的重新爬取时间失效
+	url.Fetched = now.Unix()
+	assert.NoError(t, m.Restore(&storage.Record{URL: url, State: storage.StateCook}))
+
+	m.expire(now)
+	assert.Equal(t, storage.ErrOldURL, m.Push(url))
+
+	m.expire(now.Add(time.Hour))
+	u, err := m.Get()
+	if assert.NoError(t, err) {
+		assert.Equal(t, url.Path, u.Path)
+	}
+	assert.Equal(t, 0, m.space().recrawl.Len())
+}
+
+func TestMemory_Lookup(t *testing.T) {
+	m := newMemory(t)
+
+	url := storage.URL{Path: "https://www.cdiscount.com/f-1.html", Depth: 1, Parent: "https://www.cdiscount.com", Discovered: 100}
+	_, err := m.Lookup(url.Path)
+	assert.Equal(t, storage.ErrNoURL, err)
+
+	assert.NoError(t, m.Push(url))
+	u, err := m.Lookup(url.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, 1, u.Depth)
+	assert.Equal(t, url.Parent, u.Parent)
+
+	u, _ = m.Get()
+	assert.NoError(t, m.Persist(*u))
+	u, err = m.Lookup(url.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, url.Parent, u.Parent)
+	assert.Equal(t, int64(100), u.Discovered)
+	assert.NotZero(t, u.Fetched)
+}
+
+func TestMemory_Conformance(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T, opts storage.Options) storage.Storage {
+		ctx, cancel := context.WithCancel(context.Background())
+		t.Cleanup(cancel)
+		return NewMemory(ctx, opts)
+	})
+}
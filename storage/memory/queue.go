@@ -0,0 +1,147 @@
+package memory
+
+import (
+	"container/heap"
+	"sort"
+	"time"
+
+	"github.com/lack-io/cirrus/storage"
+)
+
+// item queue 中的元素
+type item struct {
+	url storage.URL
+
+	// seq 入队序号，优先级相同时先入队的先出队
+	seq uint64
+}
+
+// queue 按照优先级排序的 url 队列，同一个 url 只会入队一次
+type queue struct {
+	items []*item
+
+	// members 队列中所有的 url
+	members map[string]*item
+
+	seq uint64
+}
+
+func newQueue() *queue {
+	return &queue{
+		items:   make([]*item, 0),
+		members: map[string]*item{},
+	}
+}
+
+func (q *queue) Len() int { return len(q.items) }
+
+func (q *queue) Less(i, j int) bool {
+	if q.items[i].url.Priority != q.items[j].url.Priority {
+		return q.items[i].url.Priority > q.items[j].url.Priority
+	}
+	return q.items[i].seq < q.items[j].seq
+}
+
+func (q *queue) Swap(i, j int) { q.items[i], q.items[j] = q.items[j], q.items[i] }
+
+func (q *queue) Push(x interface{}) { q.items = append(q.items, x.(*item)) }
+
+func (q *queue) Pop() interface{} {
+	n := len(q.items)
+	it := q.items[n-1]
+	q.items[n-1] = nil
+	q.items = q.items[:n-1]
+	return it
+}
+
+// add 添加 url，url 已经在队列中时不做任何修改
+func (q *queue) add(url storage.URL) {
+	if _, ok := q.members[url.Path]; ok {
+		return
+	}
+	q.seq++
+	it := &item{url: url, seq: q.seq}
+	q.members[url.Path] = it
+	heap.Push(q, it)
+}
+
+// pop 取出优先级最高的 url
+func (q *queue) pop() (*item, bool) {
+	if q.Len() == 0 {
+		return nil, false
+	}
+	it := heap.Pop(q).(*item)
+	delete(q.members, it.url.Path)
+	return it, true
+}
+
+// get 返回队列中的 url
+func (q *queue) get(path string) (storage.URL, bool) {
+	it, ok := q.members[path]
+	if !ok {
+		return storage.URL{}, false
+	}
+	return it.url, true
+}
+
+// remove 删除队列中的 url
+func (q *queue) remove(path string) {
+	if _, ok := q.members[path]; !ok {
+		return
+	}
+	for i, it := range q.items {
+		if it.url.Path == path {
+			heap.Remove(q, i)
+			break
+		}
+	}
+	delete(q.members, path)
+}
+
+// urls 按照入队的顺序返回队列中所有的 url
+func (q *queue) urls() []storage.URL {
+	items := make([]*item, len(q.items))
+	copy(items, q.items)
+	sort.Slice(items, func(i, j int) bool { return items[i].seq < items[j].seq })
+
+	urls := make([]storage.URL, 0, len(items))
+	for _, it := range items {
+		urls = append(urls, it.url)
+	}
+	return urls
+}
+
+// due 需要重新爬取的 url 和重新爬取的时间
+type due struct {
+	path string
+
+	at time.Time
+}
+
+// schedule 按照重新爬取的时间排序的 url，最早到期的 url 在堆顶。
+// url 被再次爬取、导入或者重新放回 raw 后旧的记录不会从堆中删除，出堆时通过 cook 中的 url 判断记录是否过期
+type schedule []due
+
+func (s schedule) Len() int { return len(s) }
+
+func (s schedule) Less(i, j int) bool { return s[i].at.Before(s[j].at) }
+
+func (s schedule) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+
+func (s *schedule) Push(x interface{}) { *s = append(*s, x.(due)) }
+
+func (s *schedule) Pop() interface{} {
+	old := *s
+	n := len(old)
+	d := old[n-1]
+	*s = old[:n-1]
+	return d
+}
+
+// next 取出在 now 之前到期的最早的记录
+func (s *schedule) next(now time.Time) (due, bool) {
+	if s.Len() == 0 || now.Before((*s)[0].at) {
+		return due{}, false
+	}
+	return heap.Pop(s).(due), true
+}
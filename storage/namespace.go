@@ -0,0 +1,57 @@
+package storage
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// namespacePattern 合法的命名空间，命名空间会作为 redis 键和文件路径的一部分，不能包含 / 和 .
+var namespacePattern = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// ValidNamespace 判断 ns 是否是合法的命名空间
+func ValidNamespace(ns string) bool {
+	return namespacePattern.MatchString(ns)
+}
+
+// CheckNamespace ns 不是合法的命名空间时返回 ErrInvalidNamespace
+func CheckNamespace(ns string) error {
+	if !ValidNamespace(ns) {
+		return fmt.Errorf("%w: %q", ErrInvalidNamespace, ns)
+	}
+	return nil
+}
+
+// Invalid 返回非法命名空间 ns 的 Storage，除 Namespace 外的所有操作都返回 ErrInvalidNamespace，
+// 各个实现的 Namespace 使用它拒绝非法的命名空间
+func Invalid(parent Storage, ns string) Storage {
+	return &invalid{parent: parent, err: CheckNamespace(ns)}
+}
+
+type invalid struct {
+	parent Storage
+	err    error
+}
+
+func (s *invalid) Init() error { return s.err }
+
+func (s *invalid) Namespace(ns string) Storage { return s.parent.Namespace(ns) }
+
+func (s *invalid) Get() (*URL, error) { return nil, s.err }
+
+func (s *invalid) Push(URL) error { return s.err }
+
+func (s *invalid) Persist(URL) error { return s.err }
+
+func (s *invalid) Nack(URL, error) error { return s.err }
+
+func (s *invalid) Lookup(string) (*URL, error) { return nil, s.err }
+
+func (s *invalid) Dead() ([]*URL, error) { return nil, s.err }
+
+func (s *invalid) Requeue(string) error { return s.err }
+
+func (s *invalid) Snapshot(func(*Record) error) error { return s.err }
+
+func (s *invalid) Restore(*Record) error { return s.err }
+
+func (s *invalid) Reset() {}
@@ -2,13 +2,18 @@ package redis
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
 	"path"
+	"strconv"
+	"strings"
 	"sync/atomic"
 	"time"
 
 	"github.com/go-redis/redis/v8"
 
 	"github.com/lack-io/cirrus/config"
+	"github.com/lack-io/cirrus/internal/bloom"
 	"github.com/lack-io/cirrus/storage"
 )
 
@@ -17,25 +22,223 @@ const (
 
 	// redis 检测 redis 状态的时间间隔
 	pingInterval = time.Second * 5
+
+	// reapInterval 检查 in-flight url 租约的时间间隔
+	reapInterval = time.Second * 5
+
+	// maxBits redis bitmap 最大的长度 (512MB)
+	maxBits = 1 << 32
+
+	// snapshotBatch 导出快照时每次读取的 url 个数
+	snapshotBatch = 1000
+
+	// snapshotChunk 导出快照时布隆过滤器 bitmap 每个分片的字节数
+	snapshotChunk = 1 << 16
+
+	// seqSpan raw 中 score 为 priority * seqSpan - seq，优先级相同时先入队的 url 先出队
+	seqSpan = 1 << 32
 )
 
+// enqueue 定义 lua 函数 enqueue，使用 seq 生成入队序号，将不在 raw 中的 url 放入 raw。
+// 使用 %.0f 格式化 score，避免 lua 转换为字符串时丢失精度
+var enqueue = `
+local function enqueue(raw, seq, priority, path)
+	if redis.call('ZSCORE', raw, path) then
+		return
+	end
+	local n = redis.call('INCR', seq) % ` + strconv.FormatInt(seqSpan, 10) + `
+	redis.call('ZADD', raw, string.format('%.0f', priority * ` + strconv.FormatInt(seqSpan, 10) + ` - n), path)
+end
+`
+
+// pushScript 添加 url，已经爬取过的 url 返回 0，死信队列中的 url 返回 2，
+// 正在爬取的 url 不会重复添加
+//
+//	KEYS[1]: cook 或者 visited
+//	KEYS[2]: inflight
+//	KEYS[3]: raw
+//	KEYS[4]: meta
+//	KEYS[5]: dead
+//	KEYS[6]: seq
+//	ARGV[1]: url
+//	ARGV[2]: 优先级
+//	ARGV[3]: url 信息
+//	ARGV[4...]: 使用布隆过滤器时，url 在 visited 中的位置
+var pushScript = redis.NewScript(enqueue + `
+local visited
+if #ARGV > 3 then
+	visited = true
+	for i = 4, #ARGV do
+		if redis.call('GETBIT', KEYS[1], ARGV[i]) == 0 then
+			visited = false
+			break
+		end
+	end
+else
+	visited = redis.call('HEXISTS', KEYS[1], ARGV[1]) == 1
+end
+if visited then
+	return 0
+end
+if redis.call('ZSCORE', KEYS[5], ARGV[1]) then
+	return 2
+end
+if redis.call('ZSCORE', KEYS[2], ARGV[1]) then
+	return 1
+end
+redis.call('HSETNX', KEYS[4], ARGV[1], ARGV[3])
+enqueue(KEYS[3], KEYS[6], tonumber(ARGV[2]), ARGV[1])
+return 1
+`)
+
+// getScript 从 raw 中取出优先级最高的 url，并将 url 添加到 in-flight 中
+//
+//	KEYS[1]: raw
+//	KEYS[2]: inflight
+//	KEYS[3]: meta
+//	ARGV[1]: 租约到期时间
+var getScript = redis.NewScript(`
+local r = redis.call('ZPOPMAX', KEYS[1])
+if #r == 0 then
+	return false
+end
+redis.call('ZADD', KEYS[2], ARGV[1], r[1])
+return {r[1], redis.call('HGET', KEYS[3], r[1]) or ''}
+`)
+
+// failScript 记录 in-flight 中的 url 爬取失败，将 url 重新放回 raw，
+// 达到最大爬取次数时放入死信队列并返回 2
+//
+//	KEYS[1]: inflight
+//	KEYS[2]: raw
+//	KEYS[3]: meta
+//	KEYS[4]: dead
+//	KEYS[5]: seq
+//	ARGV[1]: url
+//	ARGV[2]: 失败原因
+//	ARGV[3]: 最大爬取次数
+//	ARGV[4]: 当前时间
+var failScript = redis.NewScript(enqueue + `
+if redis.call('ZREM', KEYS[1], ARGV[1]) == 0 then
+	return 0
+end
+local url = {path = ARGV[1]}
+local data = redis.call('HGET', KEYS[3], ARGV[1])
+if data then
+	url = cjson.decode(data)
+end
+url.attempts = (url.attempts or 0) + 1
+if ARGV[2] ~= '' then
+	url.lastError = ARGV[2]
+end
+redis.call('HSET', KEYS[3], ARGV[1], cjson.encode(url))
+local max = tonumber(ARGV[3])
+if max > 0 and url.attempts >= max then
+	redis.call('ZADD', KEYS[4], ARGV[4], ARGV[1])
+	return 2
+end
+enqueue(KEYS[2], KEYS[5], url.priority or 0, ARGV[1])
+return 1
+`)
+
+// requeueScript 将死信队列中的 url 重新放回 raw，并清空爬取次数
+//
+//	KEYS[1]: dead
+//	KEYS[2]: raw
+//	KEYS[3]: meta
+//	KEYS[4]: seq
+//	ARGV[1]: url
+var requeueScript = redis.NewScript(enqueue + `
+if redis.call('ZREM', KEYS[1], ARGV[1]) == 0 then
+	return 0
+end
+local priority = 0
+local data = redis.call('HGET', KEYS[3], ARGV[1])
+if data then
+	local url = cjson.decode(data)
+	url.attempts = 0
+	priority = url.priority or 0
+	redis.call('HSET', KEYS[3], ARGV[1], cjson.encode(url))
+end
+enqueue(KEYS[2], KEYS[4], priority, ARGV[1])
+return 1
+`)
+
+// recrawlScript 将 recrawl 中到期的 url 重新放回 raw，并清空爬取次数，返回放回的 url 个数
+//
+//	KEYS[1]: recrawl
+//	KEYS[2]: raw
+//	KEYS[3]: meta
+//	KEYS[4]: cook
+//	KEYS[5]: seq
+//	ARGV[1]: 当前时间
+//	ARGV[2]: 每次处理的 url 个数
+var recrawlScript = redis.NewScript(enqueue + `
+local paths = redis.call('ZRANGEBYSCORE', KEYS[1], '-inf', ARGV[1], 'LIMIT', 0, ARGV[2])
+for _, path in ipairs(paths) do
+	redis.call('ZREM', KEYS[1], path)
+	local priority = 0
+	local data = redis.call('HGET', KEYS[3], path)
+	if data then
+		local url = cjson.decode(data)
+		url.attempts = nil
+		url.lastError = nil
+		priority = url.priority or 0
+		redis.call('HSET', KEYS[3], path, cjson.encode(url))
+	end
+	redis.call('HDEL', KEYS[4], path)
+	enqueue(KEYS[2], KEYS[5], priority, path)
+end
+return #paths
+`)
+
 type Redis struct {
 	// ctx 控制 Redis 的停止
 	ctx context.Context
 
+	opts storage.Options
+
+	// ns 命名空间，所有的 key 都以 /cirrus/<ns> 为前缀
+	ns string
+
 	// cli redis 客户端
 	cli *redis.Client
 
-	// raw redis hash 表的名称，存储未被爬取过的 url
+	// raw redis 有序集合的名称，存储未被爬取过的 url，score 为 priority * seqSpan - seq，
+	// 优先级的绝对值需要小于 2^21，否则 score 超出 float64 的精度
 	raw string
 
-	// cook redis hash 表名称，存储爬取过的 url
+	// seq redis 字符串的名称，url 放入 raw 时的入队序号
+	seq string
+
+	// inflight redis 有序集合的名称，存储正在爬取的 url，score 为租约的到期时间
+	inflight string
+
+	// meta redis hash 表名称，存储 raw, inflight, dead 和 recrawl 中 url 的信息
+	meta string
+
+	// recrawl redis 有序集合的名称，存储需要重新爬取的 url，score 为重新爬取的时间
+	recrawl string
+
+	// dead redis 有序集合的名称，存储超过最大爬取次数的 url，score 为进入死信队列的时间
+	dead string
+
+	// cook redis hash 表名称，存储爬取过的 url 的信息
 	cook string
 
+	// visited redis bitmap 名称，使用布隆过滤器时代替 cook 记录爬取过的 url
+	visited string
+
+	// bits 布隆过滤器 bit 数组的长度
+	bits uint64
+
+	// hashes 布隆过滤器 hash 函数的个数
+	hashes uint64
+
 	ready *atomic.Value
 }
 
-func NewRedis(ctx context.Context, cfg *config.StorageRedis) *Redis {
+func NewRedis(ctx context.Context, cfg *config.StorageRedis, opts storage.Options) *Redis {
 	cli := redis.NewClient(&redis.Options{
 		Addr:         cfg.Addr,
 		Username:     cfg.Username,
@@ -48,18 +251,40 @@ func NewRedis(ctx context.Context, cfg *config.StorageRedis) *Redis {
 
 	rdb := &Redis{
 		ctx:   ctx,
+		opts:  opts,
 		cli:   cli,
-		raw:   path.Join(prefix, "raw"),
-		cook:  path.Join(prefix, "cook"),
 		ready: &atomic.Value{},
 	}
 
+	if opts.Bloom != nil {
+		rdb.bits, rdb.hashes = bloom.Estimate(opts.Bloom.Capacity, opts.Bloom.FPRate)
+	}
+
 	rdb.ready.Store(false)
 
-	return rdb
+	return rdb.use(storage.DefaultNamespace)
+}
+
+// use 返回命名空间 ns 中的 Redis，和 r 共享同一个 redis 客户端
+func (r *Redis) use(ns string) *Redis {
+	n := *r
+	n.ns = ns
+	n.raw = path.Join(prefix, ns, "raw")
+	n.seq = path.Join(prefix, ns, "seq")
+	n.inflight = path.Join(prefix, ns, "inflight")
+	n.meta = path.Join(prefix, ns, "meta")
+	n.recrawl = path.Join(prefix, ns, "recrawl")
+	n.dead = path.Join(prefix, ns, "dead")
+	n.cook = path.Join(prefix, ns, "cook")
+	n.visited = path.Join(prefix, ns, "visited")
+	return &n
 }
 
 func (r *Redis) Init() error {
+	if r.bits > maxBits {
+		return fmt.Errorf("%w: bloom filter needs %d bits, more than redis bitmap limit", storage.ErrStorage, r.bits)
+	}
+
 	c := r.cli.Ping(r.ctx)
 	if c.Err() != nil {
 		return c.Err()
@@ -68,9 +293,17 @@ func (r *Redis) Init() error {
 	r.cli.HSet(r.ctx, r.cook, "1")
 	r.ready.Store(true)
 	go r.ping()
+	go r.reap()
 	return nil
 }
 
+func (r *Redis) Namespace(ns string) storage.Storage {
+	if !storage.ValidNamespace(ns) {
+		return storage.Invalid(r, ns)
+	}
+	return r.use(ns)
+}
+
 func (r *Redis) ping() {
 	timer := time.NewTicker(pingInterval)
 	for {
@@ -88,16 +321,133 @@ func (r *Redis) ping() {
 	}
 }
 
+// reap 将所有命名空间中租约到期和需要重新爬取的 url 重新放回 raw
+func (r *Redis) reap() {
+	timer := time.NewTicker(reapInterval)
+	for {
+		select {
+		case <-r.ctx.Done():
+			timer.Stop()
+			return
+		case now := <-timer.C:
+			_ = r.expire(now)
+		}
+	}
+}
+
+func (r *Redis) expire(now time.Time) error {
+	if !r.ready.Load().(bool) {
+		return storage.ErrStorage
+	}
+
+	// 通过 inflight 和 recrawl 的 key 找到所有需要处理的命名空间
+	namespaces := map[string]struct{}{}
+	for _, name := range []string{"inflight", "recrawl"} {
+		iter := r.cli.Scan(r.ctx, 0, path.Join(prefix, "*", name), 0).Iterator()
+		for iter.Next(r.ctx) {
+			// * 也匹配 /，跳过不属于单个命名空间的键
+			ns := strings.TrimSuffix(strings.TrimPrefix(iter.Val(), prefix+"/"), "/"+name)
+			if storage.ValidNamespace(ns) {
+				namespaces[ns] = struct{}{}
+			}
+		}
+		if err := iter.Err(); err != nil {
+			return err
+		}
+	}
+
+	for ns := range namespaces {
+		n := r.use(ns)
+		if err := n.expireNamespace(now); err != nil {
+			return err
+		}
+		if err := n.recrawlNamespace(now); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// recrawlNamespace 将当前命名空间中需要重新爬取的 url 重新放回 raw
+func (r *Redis) recrawlNamespace(now time.Time) error {
+	keys := []string{r.recrawl, r.raw, r.meta, r.cook, r.seq}
+	for {
+		n, err := recrawlScript.Run(r.ctx, r.cli, keys, now.Unix(), snapshotBatch).Int()
+		if err != nil {
+			return err
+		}
+		if n < snapshotBatch {
+			return nil
+		}
+	}
+}
+
+// expireNamespace 将当前命名空间中租约到期的 url 重新放回 raw
+func (r *Redis) expireNamespace(now time.Time) error {
+	result := r.cli.ZRangeByScore(r.ctx, r.inflight, &redis.ZRangeBy{
+		Min: "-inf",
+		Max: strconv.FormatInt(now.Unix(), 10),
+	})
+	if result.Err() != nil {
+		return result.Err()
+	}
+
+	for _, member := range result.Val() {
+		_, err := r.fail(member, storage.ErrLeaseExpired)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// fail 记录 url 爬取失败，返回 url 是否进入了死信队列
+func (r *Redis) fail(path string, reason error) (bool, error) {
+	var msg string
+	if reason != nil {
+		msg = reason.Error()
+	}
+
+	keys := []string{r.inflight, r.raw, r.meta, r.dead, r.seq}
+	n, err := failScript.Run(r.ctx, r.cli, keys, path, msg, r.opts.MaxAttempts, time.Now().Unix()).Int()
+	if err != nil {
+		return false, err
+	}
+	return n == 2, nil
+}
+
+// locations 返回 url 在布隆过滤器中的位置
+func (r *Redis) locations(path string) []uint64 {
+	return bloom.Locations([]byte(path), r.hashes, r.bits)
+}
+
+// decode 解析 meta 中存储的 url 信息
+func (r *Redis) decode(path string, data interface{}) *storage.URL {
+	url := &storage.URL{}
+	if s, ok := data.(string); ok && s != "" {
+		_ = json.Unmarshal([]byte(s), url)
+	}
+	url.Path = path
+	url.Storage = r
+	return url
+}
+
 func (r *Redis) Get() (*storage.URL, error) {
 	if !r.ready.Load().(bool) {
 		return nil, storage.ErrStorage
 	}
 
-	result := r.cli.SPop(r.ctx, r.raw)
-	if result.Err() != nil {
-		return nil, result.Err()
+	deadline := time.Now().Add(r.opts.Lease).Unix()
+	result, err := getScript.Run(r.ctx, r.cli, []string{r.raw, r.inflight, r.meta}, deadline).Result()
+	if err == redis.Nil {
+		return nil, storage.ErrNoURL
+	}
+	if err != nil {
+		return nil, err
 	}
-	return &storage.URL{Path: result.Val(), Storage: r}, nil
+
+	values := result.([]interface{})
+	return r.decode(values[0].(string), values[1]), nil
 }
 
 func (r *Redis) Push(url storage.URL) error {
@@ -105,11 +455,30 @@ func (r *Redis) Push(url storage.URL) error {
 		return storage.ErrStorage
 	}
 
-	if r.cli.HExists(r.ctx, r.cook, url.Path).Val() {
-		return storage.ErrOldURL
+	data, err := json.Marshal(url)
+	if err != nil {
+		return err
 	}
 
-	return r.cli.SAdd(r.ctx, r.raw, url.Path).Err()
+	keys := []string{r.cook, r.inflight, r.raw, r.meta, r.dead, r.seq}
+	args := []interface{}{url.Path, url.Priority, data}
+	if r.bits > 0 {
+		keys[0] = r.visited
+		for _, l := range r.locations(url.Path) {
+			args = append(args, l)
+		}
+	}
+	n, err := pushScript.Run(r.ctx, r.cli, keys, args...).Int()
+	if err != nil {
+		return err
+	}
+	switch n {
+	case 0:
+		return storage.ErrOldURL
+	case 2:
+		return storage.ErrDeadURL
+	}
+	return nil
 }
 
 func (r *Redis) Persist(url storage.URL) error {
@@ -117,12 +486,284 @@ func (r *Redis) Persist(url storage.URL) error {
 		return storage.ErrStorage
 	}
 
+	url.Storage = nil
+	url.Attempts, url.LastError = 0, ""
+	url.Fetched = time.Now().Unix()
+	_, err := r.cli.TxPipelined(r.ctx, func(pipe redis.Pipeliner) error {
+		pipe.ZRem(r.ctx, r.inflight, url.Path)
+		return r.visit(pipe, url)
+	})
+	return err
+}
+
+// visit 记录爬取过的 url，需要重新爬取的 url 同时保存到 recrawl 中
+func (r *Redis) visit(pipe redis.Pipeliner, url storage.URL) error {
+	data, err := json.Marshal(url)
+	if err != nil {
+		return err
+	}
+
+	if r.bits > 0 {
+		for _, l := range r.locations(url.Path) {
+			pipe.SetBit(r.ctx, r.visited, int64(l), 1)
+		}
+	} else {
+		pipe.HSet(r.ctx, r.cook, url.Path, data)
+	}
+
+	due, ok := r.opts.Due(url)
+	if !ok {
+		pipe.HDel(r.ctx, r.meta, url.Path)
+		pipe.ZRem(r.ctx, r.recrawl, url.Path)
+		return nil
+	}
+	pipe.HSet(r.ctx, r.meta, url.Path, data)
+	pipe.ZAdd(r.ctx, r.recrawl, &redis.Z{Score: float64(due.Unix()), Member: url.Path})
+	return nil
+}
 
-	return r.cli.HSet(r.ctx, r.cook, url.Path, 1).Err()
+func (r *Redis) Nack(url storage.URL, reason error) error {
+	if !r.ready.Load().(bool) {
+		return storage.ErrStorage
+	}
+
+	isDead, err := r.fail(url.Path, reason)
+	if err != nil {
+		return err
+	}
+	if isDead {
+		return storage.ErrDeadURL
+	}
+	return nil
+}
+
+// Lookup 查询 url 的信息，使用布隆过滤器时无法查询爬取完成并且不需要重新爬取的 url
+func (r *Redis) Lookup(path string) (*storage.URL, error) {
+	if !r.ready.Load().(bool) {
+		return nil, storage.ErrStorage
+	}
+
+	data, err := r.cli.HGet(r.ctx, r.meta, path).Result()
+	if err == redis.Nil && r.bits == 0 {
+		data, err = r.cli.HGet(r.ctx, r.cook, path).Result()
+	}
+	if err == redis.Nil {
+		return nil, storage.ErrNoURL
+	}
+	if err != nil {
+		return nil, err
+	}
+	return r.decode(path, data), nil
+}
+
+func (r *Redis) Dead() ([]*storage.URL, error) {
+	if !r.ready.Load().(bool) {
+		return nil, storage.ErrStorage
+	}
+
+	paths, err := r.cli.ZRange(r.ctx, r.dead, 0, -1).Result()
+	if err != nil {
+		return nil, err
+	}
+	if len(paths) == 0 {
+		return []*storage.URL{}, nil
+	}
+
+	values, err := r.cli.HMGet(r.ctx, r.meta, paths...).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	urls := make([]*storage.URL, 0, len(paths))
+	for i, path := range paths {
+		urls = append(urls, r.decode(path, values[i]))
+	}
+	return urls, nil
+}
+
+func (r *Redis) Requeue(path string) error {
+	if !r.ready.Load().(bool) {
+		return storage.ErrStorage
+	}
+
+	n, err := requeueScript.Run(r.ctx, r.cli, []string{r.dead, r.raw, r.meta, r.seq}, path).Int()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return fmt.Errorf("%w: %s", storage.ErrNoURL, path)
+	}
+	return nil
+}
+
+func (r *Redis) Snapshot(fn func(*storage.Record) error) error {
+	if !r.ready.Load().(bool) {
+		return storage.ErrStorage
+	}
+
+	for _, z := range []struct {
+		key   string
+		state storage.State
+	}{
+		{r.raw, storage.StateRaw},
+		{r.inflight, storage.StateInflight},
+		{r.dead, storage.StateDead},
+	} {
+		if err := r.snapshotZSet(z.key, z.state, fn); err != nil {
+			return err
+		}
+	}
+
+	if r.bits > 0 {
+		// 布隆过滤器无法列出爬取过的 url，只导出需要重新爬取的 url 和 bitmap
+		if err := r.snapshotZSet(r.recrawl, storage.StateCook, fn); err != nil {
+			return err
+		}
+		return r.snapshotVisited(fn)
+	}
+
+	var cursor uint64
+	for {
+		keys, next, err := r.cli.HScan(r.ctx, r.cook, cursor, "", snapshotBatch).Result()
+		if err != nil {
+			return err
+		}
+
+		// HSCAN 返回 field 和 value 交替的列表，需要重新爬取的 url 以 meta 中的信息为准
+		paths := make([]string, 0, len(keys)/2)
+		for i := 0; i < len(keys); i += 2 {
+			paths = append(paths, keys[i])
+		}
+		var values []interface{}
+		if len(paths) > 0 {
+			if values, err = r.cli.HMGet(r.ctx, r.meta, paths...).Result(); err != nil {
+				return err
+			}
+		}
+
+		for i, path := range paths {
+			data := values[i]
+			if data == nil {
+				data = keys[i*2+1]
+			}
+			record := &storage.Record{URL: *r.decode(path, data), State: storage.StateCook}
+			record.Storage = nil
+			if err = fn(record); err != nil {
+				return err
+			}
+		}
+		if next == 0 {
+			return nil
+		}
+		cursor = next
+	}
+}
+
+// snapshotZSet 导出有序集合 key 中的 url，url 的信息从 meta 中读取
+func (r *Redis) snapshotZSet(key string, state storage.State, fn func(*storage.Record) error) error {
+	for start := int64(0); ; start += snapshotBatch {
+		members, err := r.cli.ZRangeWithScores(r.ctx, key, start, start+snapshotBatch-1).Result()
+		if err != nil {
+			return err
+		}
+		if len(members) == 0 {
+			return nil
+		}
+
+		paths := make([]string, 0, len(members))
+		for _, m := range members {
+			paths = append(paths, m.Member.(string))
+		}
+		values, err := r.cli.HMGet(r.ctx, r.meta, paths...).Result()
+		if err != nil {
+			return err
+		}
+
+		for i, m := range members {
+			record := &storage.Record{URL: *r.decode(paths[i], values[i]), State: state}
+			record.Storage = nil
+			if state == storage.StateInflight {
+				record.Deadline = int64(m.Score)
+			}
+			if err = fn(record); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// snapshotVisited 分片导出布隆过滤器的 bitmap，跳过全部为 0 的分片
+func (r *Redis) snapshotVisited(fn func(*storage.Record) error) error {
+	size, err := r.cli.StrLen(r.ctx, r.visited).Result()
+	if err != nil {
+		return err
+	}
+
+	for offset := int64(0); offset < size; offset += snapshotChunk {
+		data, err := r.cli.GetRange(r.ctx, r.visited, offset, offset+snapshotChunk-1).Bytes()
+		if err != nil {
+			return err
+		}
+		if strings.Trim(string(data), "\x00") == "" {
+			continue
+		}
+		if err = fn(&storage.Record{State: storage.StateVisited, Offset: offset, Bits: data}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *Redis) Restore(record *storage.Record) error {
+	if !r.ready.Load().(bool) {
+		return storage.ErrStorage
+	}
+
+	if record.State == storage.StateVisited {
+		if r.bits == 0 {
+			return fmt.Errorf("%w: bloom filter is disabled", storage.ErrSnapshot)
+		}
+		return r.cli.SetRange(r.ctx, r.visited, record.Offset, string(record.Bits)).Err()
+	}
+
+	url := record.URL
+	data, err := json.Marshal(url)
+	if err != nil {
+		return err
+	}
+	seq, err := r.cli.Incr(r.ctx, r.seq).Result()
+	if err != nil {
+		return err
+	}
+
+	_, err = r.cli.TxPipelined(r.ctx, func(pipe redis.Pipeliner) error {
+		pipe.ZRem(r.ctx, r.raw, url.Path)
+		pipe.ZRem(r.ctx, r.inflight, url.Path)
+		pipe.ZRem(r.ctx, r.dead, url.Path)
+		pipe.ZRem(r.ctx, r.recrawl, url.Path)
+		if r.bits == 0 {
+			pipe.HDel(r.ctx, r.cook, url.Path)
+		}
+
+		switch record.State {
+		case storage.StateRaw, storage.StateInflight:
+			pipe.HSet(r.ctx, r.meta, url.Path, data)
+			pipe.ZAdd(r.ctx, r.raw, &redis.Z{Score: float64(url.Priority)*seqSpan - float64(seq%seqSpan), Member: url.Path})
+		case storage.StateDead:
+			pipe.HSet(r.ctx, r.meta, url.Path, data)
+			pipe.ZAdd(r.ctx, r.dead, &redis.Z{Score: float64(time.Now().Unix()), Member: url.Path})
+		case storage.StateCook:
+			if url.Fetched == 0 {
+				url.Fetched = time.Now().Unix()
+			}
+			return r.visit(pipe, url)
+		}
+		return nil
+	})
+	return err
 }
 
 func (r *Redis) Reset() {
-	// 清除访问过的 URL
-	r.cli.Del(r.ctx, r.cook)
-	r.cli.Del(r.ctx, r.raw)
+	// 清除当前命名空间中访问过的 URL，不影响其他命名空间
+	r.cli.Del(r.ctx, r.cook, r.visited, r.raw, r.seq, r.inflight, r.meta, r.dead, r.recrawl)
 }
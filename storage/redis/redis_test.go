@@ -2,52 +2,435 @@ package redis
 
 import (
 	"context"
+	"errors"
+	"os"
 	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+	"github.com/stretchr/testify/assert"
 
 	"github.com/lack-io/cirrus/config"
 	"github.com/lack-io/cirrus/storage"
+	"github.com/lack-io/cirrus/storage/storagetest"
 )
 
-var ob = &Redis{}
+// addr 设置了 CIRRUS_TEST_REDIS 时使用该地址的 redis-server，否则使用 miniredis
+func addr(t *testing.T) string {
+	if addr := os.Getenv("CIRRUS_TEST_REDIS"); addr != "" {
+		return addr
+	}
+	return miniredis.RunT(t).Addr()
+}
 
-const (
-	addr     = "192.168.10.10:6379"
-	username = ""
-	password = ""
-)
+func newRedis(t *testing.T) *Redis {
+	return newRedisWith(t, storage.Options{Lease: time.Minute})
+}
 
-func newRedis() error {
-	var err error
-	ctx := context.Background()
-	cfg := &config.StorageRedis{
-		Addr: addr,
-		Pools: 3,
+func newRedisWith(t *testing.T, opts storage.Options) *Redis {
+	ob := NewRedis(context.Background(), &config.StorageRedis{Addr: addr(t), Pools: 3}, opts)
+	if err := ob.Init(); err != nil {
+		t.Fatal(err)
 	}
-	ob = NewRedis(ctx, cfg)
-	err = ob.Init()
-	return err
+	ob.Reset()
+	t.Cleanup(ob.Reset)
+	return ob
 }
 
 func TestRedis_Push(t *testing.T) {
-	newRedis()
+	ob := newRedis(t)
+	url := storage.URL{Path: "https://www.google.com"}
+
+	assert.NoError(t, ob.Push(url))
+	u, err := ob.Get()
+	if assert.NoError(t, err) {
+		assert.Equal(t, url.Path, u.Path)
+	}
+}
+
+func TestRedis_Persist(t *testing.T) {
+	ob := newRedis(t)
+	url := storage.URL{Path: "https://www.google.com"}
+
+	assert.NoError(t, ob.Persist(url))
+	assert.Equal(t, storage.ErrOldURL, ob.Push(url))
+}
+
+func TestRedis_Reset(t *testing.T) {
+	ob := newRedis(t)
 	url := storage.URL{Path: "https://www.google.com"}
 
-	err := ob.Push(url)
+	assert.NoError(t, ob.Persist(url))
+	ob.Reset()
+	assert.NoError(t, ob.Push(url))
+}
+
+func TestRedis_Priority(t *testing.T) {
+	ob := newRedis(t)
+
+	assert.NoError(t, ob.Push(storage.URL{Path: "https://www.cdiscount.com/a.html"}))
+	assert.NoError(t, ob.Push(storage.URL{Path: "https://www.cdiscount.com/f-1.html", Priority: 10}))
+	assert.NoError(t, ob.Push(storage.URL{Path: "https://www.cdiscount.com/b.html", Priority: 5}))
+	assert.NoError(t, ob.Push(storage.URL{Path: "https://www.cdiscount.com/z.html", Priority: -1}))
+	assert.NoError(t, ob.Push(storage.URL{Path: "https://www.cdiscount.com/y.html", Priority: 100000}))
+
+	expect := []string{
+		"https://www.cdiscount.com/y.html",
+		"https://www.cdiscount.com/f-1.html",
+		"https://www.cdiscount.com/b.html",
+		"https://www.cdiscount.com/a.html",
+		"https://www.cdiscount.com/z.html",
+	}
+	for _, path := range expect {
+		u, err := ob.Get()
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, path, u.Path)
+	}
+	_, err := ob.Get()
+	assert.Equal(t, storage.ErrNoURL, err)
+}
+
+func TestRedis_Nack(t *testing.T) {
+	ob := newRedis(t)
+
+	url := storage.URL{Path: "https://www.cdiscount.com", Priority: 3}
+	assert.NoError(t, ob.Push(url))
+	u, err := ob.Get()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// in-flight 状态的 url 不会被重复添加
+	assert.NoError(t, ob.Push(url))
+	_, err = ob.Get()
+	assert.Equal(t, storage.ErrNoURL, err)
+
+	assert.NoError(t, ob.Nack(*u, errors.New("timeout")))
+	u, err = ob.Get()
 	if err != nil {
 		t.Fatal(err)
 	}
+	assert.Equal(t, url.Path, u.Path)
+	assert.Equal(t, 3, u.Priority)
+	assert.Equal(t, 1, u.Attempts)
+	assert.Equal(t, "timeout", u.LastError)
 }
 
-func TestRedis_Persist(t *testing.T) {
-	newRedis()
+func TestRedis_Expire(t *testing.T) {
+	ob := newRedis(t)
+
+	url := storage.URL{Path: "https://www.cdiscount.com"}
+	assert.NoError(t, ob.Push(url))
+	_, err := ob.Get()
+	if err != nil {
+		t.Fatal(err)
+	}
+	lease, err := ob.cli.ZScore(ob.ctx, ob.inflight, url.Path).Result()
+	if assert.NoError(t, err) {
+		assert.InDelta(t, time.Now().Add(time.Minute).Unix(), lease, 1)
+	}
+
+	assert.NoError(t, ob.expire(time.Now()))
+	_, err = ob.Get()
+	assert.Equal(t, storage.ErrNoURL, err)
+
+	// 租约到期后从 inflight 移回 raw，并记录一次失败
+	assert.NoError(t, ob.expire(time.Now().Add(time.Minute*2)))
+	n, err := ob.cli.ZCard(ob.ctx, ob.inflight).Result()
+	if assert.NoError(t, err) {
+		assert.Equal(t, int64(0), n)
+	}
+	u, err := ob.Get()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, url.Path, u.Path)
+	assert.Equal(t, 1, u.Attempts)
+	assert.Equal(t, storage.ErrLeaseExpired.Error(), u.LastError)
+}
+
+func TestRedis_Dead(t *testing.T) {
+	ob := newRedisWith(t, storage.Options{Lease: time.Minute, MaxAttempts: 2})
+
+	url := storage.URL{Path: "https://www.cdiscount.com/f-1.html", Priority: 10}
+	assert.NoError(t, ob.Push(url))
+	for i := 1; i <= 2; i++ {
+		u, err := ob.Get()
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = ob.Nack(*u, errors.New("timeout"))
+		if i < 2 {
+			assert.NoError(t, err)
+		} else {
+			assert.Equal(t, storage.ErrDeadURL, err)
+		}
+	}
+
+	// 死信队列中的 url 不会被再次获取或者添加
+	_, err := ob.Get()
+	assert.Equal(t, storage.ErrNoURL, err)
+	assert.Equal(t, storage.ErrDeadURL, ob.Push(url))
+
+	urls, err := ob.Dead()
+	if assert.NoError(t, err) && assert.Len(t, urls, 1) {
+		assert.Equal(t, url.Path, urls[0].Path)
+		assert.Equal(t, 2, urls[0].Attempts)
+		assert.Equal(t, "timeout", urls[0].LastError)
+	}
+
+	assert.NoError(t, ob.Requeue(url.Path))
+	assert.True(t, errors.Is(ob.Requeue(url.Path), storage.ErrNoURL))
+	urls, err = ob.Dead()
+	if assert.NoError(t, err) {
+		assert.Len(t, urls, 0)
+	}
+
+	// 重新放回 raw 后清空爬取次数，保留优先级
+	u, err := ob.Get()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, url.Path, u.Path)
+	assert.Equal(t, 0, u.Attempts)
+	assert.Equal(t, 10, u.Priority)
+	assert.NoError(t, ob.Nack(*u, errors.New("timeout")))
+}
+
+func TestRedis_Recrawl(t *testing.T) {
+	ob := newRedisWith(t, storage.Options{
+		Lease:   time.Minute,
+		Recrawl: map[string]time.Duration{"link": time.Hour},
+	})
+
+	group := storage.URL{Path: "https://www.cdiscount.com", Kind: "group"}
+	link := storage.URL{Path: "https://www.cdiscount.com/f-1.html", Priority: 10, Kind: "link"}
+	assert.NoError(t, ob.Push(group))
+	assert.NoError(t, ob.Push(link))
+	for i := 0; i < 2; i++ {
+		u, err := ob.Get()
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.NoError(t, ob.Persist(*u))
+	}
+	due, err := ob.cli.ZScore(ob.ctx, ob.recrawl, link.Path).Result()
+	if assert.NoError(t, err) {
+		assert.InDelta(t, time.Now().Add(time.Hour).Unix(), due, 1)
+	}
+
+	assert.NoError(t, ob.expire(time.Now().Add(time.Minute)))
+	_, err = ob.Get()
+	assert.Equal(t, storage.ErrNoURL, err)
+	assert.Equal(t, storage.ErrOldURL, ob.Push(link))
+
+	// 只有配置了重新爬取间隔的 url 会被重新放回 raw
+	assert.NoError(t, ob.expire(time.Now().Add(time.Hour)))
+	n, err := ob.cli.ZCard(ob.ctx, ob.recrawl).Result()
+	if assert.NoError(t, err) {
+		assert.Equal(t, int64(0), n)
+	}
+	assert.Equal(t, storage.ErrOldURL, ob.Push(group))
+	assert.NoError(t, ob.Push(link))
+	u, err := ob.Get()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, link.Path, u.Path)
+	assert.Equal(t, 10, u.Priority)
+	assert.NotZero(t, u.Fetched)
+	_, err = ob.Get()
+	assert.Equal(t, storage.ErrNoURL, err)
+}
+
+func TestRedis_Snapshot(t *testing.T) {
+	ob := newRedisWith(t, storage.Options{Lease: time.Minute, MaxAttempts: 1})
+	assert.NoError(t, ob.Push(storage.URL{Path: "https://www.cdiscount.com/a.html"}))
+	assert.NoError(t, ob.Push(storage.URL{Path: "https://www.cdiscount.com/f-1.html", Priority: 10}))
+	assert.NoError(t, ob.Push(storage.URL{Path: "https://www.cdiscount.com/f-2.html", Priority: 5}))
+	assert.NoError(t, ob.Persist(storage.URL{Path: "https://www.cdiscount.com"}))
+	u, _ := ob.Get()
+	assert.Equal(t, "https://www.cdiscount.com/f-1.html", u.Path)
+	u, _ = ob.Get()
+	assert.Equal(t, storage.ErrDeadURL, ob.Nack(*u, errors.New("timeout")))
+
+	records := make([]*storage.Record, 0)
+	err := ob.Snapshot(func(r *storage.Record) error {
+		records = append(records, r)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	states := make([]string, 0)
+	for _, r := range records {
+		assert.Nil(t, r.Storage)
+		states = append(states, string(r.State)+" "+r.Path)
+	}
+	assert.Equal(t, []string{
+		"raw https://www.cdiscount.com/a.html",
+		"inflight https://www.cdiscount.com/f-1.html",
+		"dead https://www.cdiscount.com/f-2.html",
+		"cook https://www.cdiscount.com",
+	}, states)
+	assert.NotZero(t, records[1].Deadline)
+	assert.Equal(t, "timeout", records[2].LastError)
+
+	g := ob.Namespace("copy")
+	defer g.Reset()
+	for _, r := range records {
+		assert.NoError(t, g.Restore(r))
+	}
+	assert.Error(t, g.Restore(&storage.Record{State: storage.StateVisited}))
+	assert.Equal(t, storage.ErrOldURL, g.Push(storage.URL{Path: "https://www.cdiscount.com"}))
+	assert.Equal(t, storage.ErrDeadURL, g.Push(storage.URL{Path: "https://www.cdiscount.com/f-2.html"}))
+	// in-flight 的 url 导入后重新放回 raw
+	u, _ = g.Get()
+	assert.Equal(t, "https://www.cdiscount.com/f-1.html", u.Path)
+	assert.Equal(t, 10, u.Priority)
+	u, _ = g.Get()
+	assert.Equal(t, "https://www.cdiscount.com/a.html", u.Path)
+}
+
+func TestRedis_SnapshotBloom(t *testing.T) {
+	opts := storage.Options{Lease: time.Minute, Bloom: &storage.BloomOptions{Capacity: 10000, FPRate: 0.001}}
+	ob := newRedisWith(t, opts)
+	url := storage.URL{Path: "https://www.cdiscount.com"}
+	assert.NoError(t, ob.Persist(url))
+
+	records := make([]*storage.Record, 0)
+	err := ob.Snapshot(func(r *storage.Record) error {
+		records = append(records, r)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 布隆过滤器只能导出 bitmap
+	if assert.Len(t, records, 1) {
+		assert.Equal(t, storage.StateVisited, records[0].State)
+		assert.NotEmpty(t, records[0].Bits)
+	}
+
+	g := ob.Namespace("copy")
+	defer g.Reset()
+	assert.NoError(t, g.Restore(records[0]))
+	assert.Equal(t, storage.ErrOldURL, g.Push(url))
+	assert.NoError(t, g.Push(storage.URL{Path: "https://www.cdiscount.com/a.html"}))
+}
+
+func TestRedis_Lookup(t *testing.T) {
+	ob := newRedis(t)
+
+	url := storage.URL{Path: "https://www.cdiscount.com/f-1.html", Depth: 1, Parent: "https://www.cdiscount.com", Discovered: 100}
+	_, err := ob.Lookup(url.Path)
+	assert.Equal(t, storage.ErrNoURL, err)
+
+	assert.NoError(t, ob.Push(url))
+	u, err := ob.Lookup(url.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, 1, u.Depth)
+	assert.Equal(t, url.Parent, u.Parent)
+
+	u, _ = ob.Get()
+	assert.NoError(t, ob.Persist(*u))
+	u, err = ob.Lookup(url.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, url.Parent, u.Parent)
+	assert.Equal(t, int64(100), u.Discovered)
+	assert.NotZero(t, u.Fetched)
+}
+
+func TestRedis_LookupBloom(t *testing.T) {
+	ob := newRedisWith(t, storage.Options{
+		Lease:   time.Minute,
+		Bloom:   &storage.BloomOptions{Capacity: 10000, FPRate: 0.001},
+		Recrawl: map[string]time.Duration{"link": time.Hour},
+	})
+
+	group := storage.URL{Path: "https://www.cdiscount.com", Kind: "group"}
+	link := storage.URL{Path: "https://www.cdiscount.com/f-1.html", Kind: "link", Parent: group.Path}
+	assert.NoError(t, ob.Persist(group))
+	assert.NoError(t, ob.Persist(link))
+
+	// 布隆过滤器无法查询不需要重新爬取的 url
+	_, err := ob.Lookup(group.Path)
+	assert.Equal(t, storage.ErrNoURL, err)
+	u, err := ob.Lookup(link.Path)
+	if assert.NoError(t, err) {
+		assert.Equal(t, group.Path, u.Parent)
+	}
+}
+
+func TestRedis_Namespace(t *testing.T) {
+	ob := newRedis(t)
+	a, b := ob.Namespace("a"), ob.Namespace("b")
+	defer a.Reset()
+	defer b.Reset()
+
 	url := storage.URL{Path: "https://www.google.com"}
+	if err := a.Persist(url); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.Push(url); err != storage.ErrOldURL {
+		t.Fatalf("push to namespace a: %v", err)
+	}
+	if err := b.Push(url); err != nil {
+		t.Fatal(err)
+	}
+
+	a.Reset()
+	if err := a.Push(url); err != nil {
+		t.Fatal(err)
+	}
+	u, err := b.Get()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = u.Storage.Persist(*u); err != nil {
+		t.Fatal(err)
+	}
+}
 
-	err := ob.Persist(url)
+func TestRedis_ExpireForeignKeys(t *testing.T) {
+	ob := newRedis(t)
+	ctx := context.Background()
+
+	// 与其他程序共用 redis 时，/cirrus/*/inflight 也会匹配到多级的键
+	foreign := "/cirrus/stream/x/inflight"
+	err := ob.cli.XAdd(ctx, &redis.XAddArgs{Stream: foreign, Values: map[string]interface{}{"path": "a"}}).Err()
 	if err != nil {
 		t.Fatal(err)
 	}
+	defer ob.cli.Del(ctx, foreign)
+
+	assert.NoError(t, ob.expire(time.Now()))
+	kind, err := ob.cli.Type(ctx, foreign).Result()
+	if assert.NoError(t, err) {
+		assert.Equal(t, "stream", kind)
+	}
 }
 
-func TestRedis_Reset(t *testing.T) {
-	ob.Reset()
+func TestRedis_Conformance(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T, opts storage.Options) storage.Storage {
+		ctx, cancel := context.WithCancel(context.Background())
+		t.Cleanup(cancel)
+		return NewRedis(ctx, &config.StorageRedis{Addr: miniredis.RunT(t).Addr(), Pools: 3}, opts)
+	})
+}
+
+func TestRedis_ConformanceBloom(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T, opts storage.Options) storage.Storage {
+		ctx, cancel := context.WithCancel(context.Background())
+		t.Cleanup(cancel)
+		opts.Bloom = &storage.BloomOptions{Capacity: 10000, FPRate: 0.001}
+		return NewRedis(ctx, &config.StorageRedis{Addr: miniredis.RunT(t).Addr(), Pools: 3}, opts)
+	})
 }
@@ -0,0 +1,100 @@
+package storage
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+)
+
+var (
+	// ErrSnapshot 无效的快照记录
+	ErrSnapshot = errors.New("invalid snapshot record")
+)
+
+// State 快照中 url 的状态
+type State string
+
+const (
+	// StateRaw 未被爬取过的 url
+	StateRaw State = "raw"
+	// StateInflight 正在爬取的 url，导入时作为 raw 处理
+	StateInflight State = "inflight"
+	// StateDead 死信队列中的 url
+	StateDead State = "dead"
+	// StateCook 爬取过的 url
+	StateCook State = "cook"
+	// StateVisited 布隆过滤器 bitmap 的分片，只有使用布隆过滤器的 storage 才会导出
+	StateVisited State = "visited"
+)
+
+// Record 快照中的一条记录，导出为 JSONL 中的一行
+type Record struct {
+	URL
+
+	// State url 的状态
+	State State `json:"state"`
+
+	// Deadline in-flight 状态的 url 租约的到期时间 (unix 时间戳)
+	Deadline int64 `json:"deadline,omitempty"`
+
+	// Offset 布隆过滤器 bitmap 分片的字节偏移
+	Offset int64 `json:"offset,omitempty"`
+
+	// Bits 布隆过滤器 bitmap 分片的内容
+	Bits []byte `json:"bits,omitempty"`
+}
+
+// Export 将 s 当前命名空间中所有的记录以 JSONL 的格式写入 w，返回写入的记录数
+func Export(s Storage, w io.Writer) (int, error) {
+	var n int
+	enc := json.NewEncoder(w)
+	err := s.Snapshot(func(r *Record) error {
+		if err := enc.Encode(r); err != nil {
+			return err
+		}
+		n++
+		return nil
+	})
+	return n, err
+}
+
+// Import 从 r 中读取 JSONL 格式的记录并导入 s 的当前命名空间，返回导入的记录数，
+// 已经存在的 url 会被快照中的状态覆盖
+func Import(s Storage, r io.Reader) (int, error) {
+	var n int
+	dec := json.NewDecoder(r)
+	for {
+		record := &Record{}
+		err := dec.Decode(record)
+		if err == io.EOF {
+			return n, nil
+		}
+		if err != nil {
+			return n, fmt.Errorf("%w: line %d: %v", ErrSnapshot, n+1, err)
+		}
+		if err = record.valid(); err != nil {
+			return n, fmt.Errorf("%w: line %d", err, n+1)
+		}
+		if err = s.Restore(record); err != nil {
+			return n, err
+		}
+		n++
+	}
+}
+
+func (r *Record) valid() error {
+	switch r.State {
+	case StateRaw, StateInflight, StateDead, StateCook:
+		if r.Path == "" {
+			return fmt.Errorf("%w: missing path", ErrSnapshot)
+		}
+	case StateVisited:
+		if r.Offset < 0 {
+			return fmt.Errorf("%w: negative offset", ErrSnapshot)
+		}
+	default:
+		return fmt.Errorf("%w: unknown state %q", ErrSnapshot, r.State)
+	}
+	return nil
+}
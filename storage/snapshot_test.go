@@ -0,0 +1,97 @@
+package storage_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/lack-io/cirrus/storage"
+	"github.com/lack-io/cirrus/storage/memory"
+)
+
+func newMemory(t *testing.T) storage.Storage {
+	m := memory.NewMemory(context.Background(), storage.Options{Lease: time.Minute, MaxAttempts: 2})
+	if err := m.Init(); err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+func TestExport(t *testing.T) {
+	src := newMemory(t)
+	assert.NoError(t, src.Push(storage.URL{Path: "https://www.cdiscount.com/a.html"}))
+	assert.NoError(t, src.Push(storage.URL{Path: "https://www.cdiscount.com/f-1.html", Priority: 10}))
+	assert.NoError(t, src.Push(storage.URL{Path: "https://www.cdiscount.com/f-2.html", Priority: 10}))
+	assert.NoError(t, src.Persist(storage.URL{Path: "https://www.cdiscount.com"}))
+
+	// f-1 进入 in-flight，f-2 进入死信队列
+	u, err := src.Get()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "https://www.cdiscount.com/f-1.html", u.Path)
+	d, _ := src.Get()
+	assert.NoError(t, src.Nack(*d, errors.New("timeout")))
+	d, _ = src.Get()
+	assert.Equal(t, storage.ErrDeadURL, src.Nack(*d, errors.New("timeout")))
+
+	buf := &bytes.Buffer{}
+	n, err := storage.Export(src, buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, 4, n)
+	assert.Equal(t, 4, strings.Count(buf.String(), "\n"))
+
+	dst := newMemory(t).Namespace("copy")
+	n, err = storage.Import(dst, buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, 4, n)
+
+	assert.Equal(t, storage.ErrOldURL, dst.Push(storage.URL{Path: "https://www.cdiscount.com"}))
+	dead, _ := dst.Dead()
+	if assert.Equal(t, 1, len(dead)) {
+		assert.Equal(t, "https://www.cdiscount.com/f-2.html", dead[0].Path)
+		assert.Equal(t, 2, dead[0].Attempts)
+		assert.Equal(t, "timeout", dead[0].LastError)
+	}
+
+	// in-flight 的 url 导入后重新放回 raw
+	u, _ = dst.Get()
+	assert.Equal(t, "https://www.cdiscount.com/f-1.html", u.Path)
+	assert.Equal(t, 10, u.Priority)
+	u, _ = dst.Get()
+	assert.Equal(t, "https://www.cdiscount.com/a.html", u.Path)
+	_, err = dst.Get()
+	assert.Equal(t, storage.ErrNoURL, err)
+}
+
+func TestImport(t *testing.T) {
+	s := newMemory(t)
+
+	n, err := storage.Import(s, strings.NewReader(`{"path":"https://www.cdiscount.com","state":"raw"}
+{"path":"https://www.cdiscount.com","state":"cook"}
+`))
+	assert.NoError(t, err)
+	assert.Equal(t, 2, n)
+	assert.Equal(t, storage.ErrOldURL, s.Push(storage.URL{Path: "https://www.cdiscount.com"}))
+
+	for _, data := range []string{
+		`{"path":"https://www.cdiscount.com","state":"unknown"}`,
+		`{"state":"raw"}`,
+		`{"path":`,
+	} {
+		_, err = storage.Import(s, strings.NewReader(data))
+		assert.True(t, errors.Is(err, storage.ErrSnapshot), data)
+	}
+
+	_, err = storage.Import(s, strings.NewReader(`{"state":"visited","bits":"AQ=="}`))
+	assert.True(t, errors.Is(err, storage.ErrSnapshot))
+}
@@ -1,6 +1,11 @@
 package storage
 
-import "errors"
+import (
+	"errors"
+	"time"
+
+	"github.com/lack-io/cirrus/config"
+)
 
 var (
 	// ErrStorage storage 状态错误
@@ -17,22 +22,58 @@ var (
 	ErrSetURL = errors.New("set storage url")
 	// ErrDelURL 删除 url 时的错误
 	ErrDelURL = errors.New("del storage url")
+	// ErrDeadURL url 超过最大爬取次数，已经进入死信队列
+	ErrDeadURL = errors.New("url is dead")
+	// ErrLeaseExpired url 的租约超时
+	ErrLeaseExpired = errors.New("url lease expired")
+	// ErrInvalidNamespace 命名空间只能包含字母、数字、下划线和连字符
+	ErrInvalidNamespace = errors.New("invalid namespace")
+)
+
+const (
+	// DefaultNamespace 默认的命名空间
+	DefaultNamespace = "default"
 )
 
 type Storage interface {
 	// 初始化
 	Init() error
 
-	// 订阅 URL
+	// 返回命名空间 ns 下的 Storage，不同命名空间中的 url 互不影响，
+	// 返回的 Storage 与当前的 Storage 共享连接，不需要再次初始化
+	Namespace(ns string) Storage
+
+	// 订阅 URL，获取到的 URL 进入 in-flight 状态，直到调用 Persist 或 Nack，
+	// 租约超时仍未确认的 URL 会被重新放回 raw
 	Get() (*URL, error)
 
 	// 添加 URL
 	Push(URL) error
 
-	// 持久化 URL
+	// 持久化 URL，确认 URL 已经处理完成 (Ack)，并记录爬取完成的时间，
+	// 配置了重新爬取间隔的 URL 到期后会被重新放回 raw
 	Persist(URL) error
 
-	// Storage 重置，删除内部所有的 url
+	// 放弃处理 in-flight 状态的 URL，记录失败的原因并将 URL 重新放回 raw，
+	// URL 的爬取次数达到上限时进入死信队列，并返回 ErrDeadURL
+	Nack(URL, error) error
+
+	// 查询当前命名空间中 URL 的信息，URL 不存在时返回 ErrNoURL
+	Lookup(path string) (*URL, error)
+
+	// 获取死信队列中所有的 URL
+	Dead() ([]*URL, error)
+
+	// 将死信队列中的 URL 重新放回 raw，并清空爬取次数
+	Requeue(path string) error
+
+	// 遍历当前命名空间中所有的 url，依次调用 fn，fn 返回错误时停止遍历
+	Snapshot(fn func(*Record) error) error
+
+	// 导入一条快照记录，覆盖 url 在当前命名空间中的状态
+	Restore(*Record) error
+
+	// Storage 重置，删除当前命名空间中所有的 url
 	Reset()
 }
 
@@ -41,6 +82,143 @@ type URL struct {
 	// URL 路径
 	Path string `json:"path,omitempty"`
 
+	// Priority 优先级，数值越大越先被 Get 获取
+	Priority int `json:"priority,omitempty"`
+
+	// Attempts 爬取失败的次数
+	Attempts int `json:"attempts,omitempty"`
+
+	// LastError 最后一次爬取失败的原因
+	LastError string `json:"lastError,omitempty"`
+
+	// Kind url 的类型，用于选择重新爬取的时间间隔
+	Kind string `json:"kind,omitempty"`
+
+	// Fetched 最后一次爬取完成的时间 (unix 时间戳)，由 Persist 记录
+	Fetched int64 `json:"fetched,omitempty"`
+
+	// Depth 从任务的起始路径到 url 的深度，起始路径的深度为 0
+	Depth int `json:"depth,omitempty"`
+
+	// Parent 发现 url 的页面路径
+	Parent string `json:"parent,omitempty"`
+
+	// Discovered 第一次发现 url 的时间 (unix 时间戳)
+	Discovered int64 `json:"discovered,omitempty"`
+
 	// URL 所在的 URL 池
-	Storage Storage `json:"storage,omitempty"`
+	Storage Storage `json:"-"`
+}
+
+const (
+	// DefaultLease 默认的租约时间
+	DefaultLease = time.Minute * 5
+
+	// DefaultMaxAttempts 默认的最大爬取次数
+	DefaultMaxAttempts = 5
+
+	// DefaultBloomCapacity 布隆过滤器默认的容量
+	DefaultBloomCapacity = 10000000
+
+	// DefaultBloomFPRate 布隆过滤器默认的误判率
+	DefaultBloomFPRate = 0.001
+)
+
+// Options storage 的通用参数
+type Options struct {
+	// Lease Get 获取的 url 的租约时间
+	Lease time.Duration
+
+	// MaxAttempts url 最大的爬取次数，超过后 url 进入死信队列
+	MaxAttempts int
+
+	// Bloom 使用布隆过滤器记录爬取过的 url，为 nil 时记录所有的 url
+	Bloom *BloomOptions
+
+	// Recrawl 不同类型的 url 重新爬取的时间间隔，未配置或者为 0 的类型不会重新爬取
+	Recrawl map[string]time.Duration
+}
+
+// BloomOptions 布隆过滤器参数
+type BloomOptions struct {
+	// Capacity 预计的 url 个数
+	Capacity uint64
+
+	// FPRate 误判率
+	FPRate float64
+}
+
+// NewOptions 从配置中生成 Options，未配置的参数使用默认值
+func NewOptions(cfg *config.Storage) Options {
+	opts := Options{Lease: DefaultLease, MaxAttempts: DefaultMaxAttempts}
+	if cfg == nil {
+		return opts
+	}
+	if cfg.Lease > 0 {
+		opts.Lease = time.Second * time.Duration(cfg.Lease)
+	}
+	if cfg.MaxAttempts > 0 {
+		opts.MaxAttempts = cfg.MaxAttempts
+	}
+	for kind, ttl := range cfg.Recrawl {
+		if ttl > 0 {
+			if opts.Recrawl == nil {
+				opts.Recrawl = map[string]time.Duration{}
+			}
+			opts.Recrawl[kind] = time.Second * time.Duration(ttl)
+		}
+	}
+	if cfg.Visited == config.Bloom {
+		opts.Bloom = &BloomOptions{Capacity: DefaultBloomCapacity, FPRate: DefaultBloomFPRate}
+		if cfg.Bloom != nil && cfg.Bloom.Capacity > 0 {
+			opts.Bloom.Capacity = cfg.Bloom.Capacity
+		}
+		if cfg.Bloom != nil && cfg.Bloom.FPRate > 0 && cfg.Bloom.FPRate < 1 {
+			opts.Bloom.FPRate = cfg.Bloom.FPRate
+		}
+	}
+	return opts
+}
+
+// Fail 记录一次爬取失败，返回 url 是否达到了最大的爬取次数
+func (o Options) Fail(url *URL, reason error) bool {
+	url.Attempts++
+	if reason != nil {
+		url.LastError = reason.Error()
+	}
+	return o.MaxAttempts > 0 && url.Attempts >= o.MaxAttempts
+}
+
+// Due 返回爬取完成的 url 需要重新爬取的时间，url 的类型不需要重新爬取时返回 false
+func (o Options) Due(url URL) (time.Time, bool) {
+	ttl := o.Recrawl[url.Kind]
+	if ttl <= 0 {
+		return time.Time{}, false
+	}
+	return time.Unix(url.Fetched, 0).Add(ttl), true
+}
+
+// Provenance 沿着 url 的 Parent 在 s 中向上查找，返回从起始路径到 url 父路径的路径链，
+// 父路径的信息已经不在 s 中时 (例如 Reset 或者使用布隆过滤器)，路径链从最早能找到的路径开始
+func Provenance(s Storage, url URL) []string {
+	chain := make([]string, 0, url.Depth)
+	seen := map[string]struct{}{url.Path: {}}
+	for parent := url.Parent; parent != ""; {
+		if _, ok := seen[parent]; ok {
+			break
+		}
+		seen[parent] = struct{}{}
+		chain = append(chain, parent)
+
+		u, err := s.Lookup(parent)
+		if err != nil {
+			break
+		}
+		parent = u.Parent
+	}
+
+	for i, j := 0, len(chain)-1; i < j; i, j = i+1, j-1 {
+		chain[i], chain[j] = chain[j], chain[i]
+	}
+	return chain
 }
@@ -0,0 +1,42 @@
+package storage_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/lack-io/cirrus/storage"
+)
+
+func TestValidNamespace(t *testing.T) {
+	for _, ns := range []string{"default", "shop-42", "A_b"} {
+		assert.True(t, storage.ValidNamespace(ns), ns)
+	}
+	for _, ns := range []string{"", ".", "..", "a/b", "/cirrus", "a b", "*"} {
+		assert.False(t, storage.ValidNamespace(ns), ns)
+	}
+}
+
+func TestProvenance(t *testing.T) {
+	s := newMemory(t)
+
+	root := storage.URL{Path: "https://www.cdiscount.com"}
+	group := storage.URL{Path: "https://www.cdiscount.com/informatique.html", Depth: 1, Parent: root.Path}
+	link := storage.URL{Path: "https://www.cdiscount.com/f-1.html", Depth: 2, Parent: group.Path}
+	assert.NoError(t, s.Persist(root))
+	assert.NoError(t, s.Persist(group))
+	assert.NoError(t, s.Push(link))
+
+	assert.Equal(t, []string{root.Path, group.Path}, storage.Provenance(s, link))
+	assert.Equal(t, []string{}, storage.Provenance(s, root))
+
+	// 找不到父路径的信息时，路径链从最早能找到的路径开始
+	s.Reset()
+	assert.Equal(t, []string{group.Path}, storage.Provenance(s, link))
+
+	// 循环的父路径
+	a := storage.URL{Path: "a", Parent: "b"}
+	assert.NoError(t, s.Persist(a))
+	assert.NoError(t, s.Persist(storage.URL{Path: "b", Parent: "a"}))
+	assert.Equal(t, []string{"b"}, storage.Provenance(s, a))
+}
@@ -0,0 +1,238 @@
+// Package storagetest 提供 storage.Storage 的一致性测试，所有的 storage 实现都需要通过
+package storagetest
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/lack-io/cirrus/storage"
+)
+
+// Factory 使用 opts 创建一个未初始化的 storage，每次调用都需要返回独立的 storage，
+// 需要释放的资源通过 t.Cleanup 释放
+type Factory func(t *testing.T, opts storage.Options) storage.Storage
+
+// concurrency 并发获取 url 的协程个数
+const concurrency = 8
+
+// Run 运行所有的一致性测试
+func Run(t *testing.T, factory Factory) {
+	tests := []struct {
+		name string
+		fn   func(t *testing.T, factory Factory)
+	}{
+		{"NotReady", testNotReady},
+		{"Dedupe", testDedupe},
+		{"Persist", testPersist},
+		{"Nack", testNack},
+		{"Order", testOrder},
+		{"Reset", testReset},
+		{"Namespace", testNamespace},
+		{"ConcurrentGet", testConcurrentGet},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			tt.fn(t, factory)
+		})
+	}
+}
+
+// open 创建并初始化 storage
+func open(t *testing.T, factory Factory) storage.Storage {
+	s := factory(t, storage.Options{Lease: time.Minute})
+	if err := s.Init(); err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func testNotReady(t *testing.T, factory Factory) {
+	s := factory(t, storage.Options{Lease: time.Minute})
+	url := storage.URL{Path: "https://www.cdiscount.com"}
+
+	_, err := s.Get()
+	assert.Equal(t, storage.ErrStorage, err)
+	assert.Equal(t, storage.ErrStorage, s.Push(url))
+	assert.Equal(t, storage.ErrStorage, s.Persist(url))
+	assert.Equal(t, storage.ErrStorage, s.Nack(url, errors.New("timeout")))
+}
+
+func testDedupe(t *testing.T, factory Factory) {
+	s := open(t, factory)
+	url := storage.URL{Path: "https://www.cdiscount.com"}
+
+	for i := 0; i < 3; i++ {
+		assert.NoError(t, s.Push(url))
+	}
+	u, err := s.Get()
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, url.Path, u.Path)
+	assert.NotNil(t, u.Storage)
+
+	// 正在爬取的 url 不会重复添加
+	assert.NoError(t, s.Push(url))
+	_, err = s.Get()
+	assert.Equal(t, storage.ErrNoURL, err)
+}
+
+func testPersist(t *testing.T, factory Factory) {
+	s := open(t, factory)
+	a := storage.URL{Path: "https://www.cdiscount.com/a"}
+	b := storage.URL{Path: "https://www.cdiscount.com/b"}
+
+	assert.NoError(t, s.Push(a))
+	u, err := s.Get()
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.NoError(t, u.Storage.Persist(*u))
+	assert.Equal(t, storage.ErrOldURL, s.Push(a))
+
+	// 没有被获取的 url 也可以直接确认
+	assert.NoError(t, s.Persist(b))
+	assert.Equal(t, storage.ErrOldURL, s.Push(b))
+
+	_, err = s.Get()
+	assert.Equal(t, storage.ErrNoURL, err)
+}
+
+func testNack(t *testing.T, factory Factory) {
+	s := open(t, factory)
+	url := storage.URL{Path: "https://www.cdiscount.com"}
+
+	assert.NoError(t, s.Push(url))
+	u, err := s.Get()
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.NoError(t, u.Storage.Nack(*u, errors.New("timeout")))
+
+	u, err = s.Get()
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, url.Path, u.Path)
+	assert.Equal(t, 1, u.Attempts)
+	assert.Equal(t, "timeout", u.LastError)
+}
+
+// testOrder 优先级相同的 url 按照入队的顺序获取
+func testOrder(t *testing.T, factory Factory) {
+	s := open(t, factory)
+	paths := []string{
+		"https://www.cdiscount.com/c.html",
+		"https://www.cdiscount.com/a.html",
+		"https://www.cdiscount.com/d.html",
+		"https://www.cdiscount.com/b.html",
+	}
+	for _, path := range paths {
+		assert.NoError(t, s.Push(storage.URL{Path: path, Priority: 1}))
+	}
+
+	for _, path := range paths {
+		u, err := s.Get()
+		if !assert.NoError(t, err) {
+			return
+		}
+		assert.Equal(t, path, u.Path)
+	}
+	_, err := s.Get()
+	assert.Equal(t, storage.ErrNoURL, err)
+}
+
+func testReset(t *testing.T, factory Factory) {
+	s := open(t, factory)
+	a := storage.URL{Path: "https://www.cdiscount.com/a"}
+	b := storage.URL{Path: "https://www.cdiscount.com/b"}
+
+	assert.NoError(t, s.Push(a))
+	assert.NoError(t, s.Persist(b))
+	s.Reset()
+
+	_, err := s.Get()
+	assert.Equal(t, storage.ErrNoURL, err)
+	assert.NoError(t, s.Push(b))
+	u, err := s.Get()
+	if assert.NoError(t, err) {
+		assert.Equal(t, b.Path, u.Path)
+	}
+}
+
+func testNamespace(t *testing.T, factory Factory) {
+	s := open(t, factory)
+	x, y := s.Namespace("x"), s.Namespace("y")
+	url := storage.URL{Path: "https://www.cdiscount.com"}
+
+	assert.NoError(t, x.Persist(url))
+	assert.Equal(t, storage.ErrOldURL, x.Push(url))
+	assert.NoError(t, y.Push(url))
+
+	_, err := x.Get()
+	assert.Equal(t, storage.ErrNoURL, err)
+	u, err := y.Get()
+	if assert.NoError(t, err) {
+		assert.Equal(t, url.Path, u.Path)
+	}
+
+	// Reset 只清空当前的命名空间
+	x.Reset()
+	assert.NoError(t, x.Push(url))
+	assert.NoError(t, u.Storage.Persist(*u))
+	assert.Equal(t, storage.ErrOldURL, y.Push(url))
+
+	// 非法的命名空间不能访问其他命名空间的键
+	for _, ns := range []string{"", "..", "x/y", "*"} {
+		invalid := s.Namespace(ns)
+		assert.True(t, errors.Is(invalid.Push(url), storage.ErrInvalidNamespace), ns)
+		_, err = invalid.Get()
+		assert.True(t, errors.Is(err, storage.ErrInvalidNamespace), ns)
+		invalid.Reset()
+	}
+	assert.Equal(t, storage.ErrOldURL, y.Push(url))
+}
+
+func testConcurrentGet(t *testing.T, factory Factory) {
+	s := open(t, factory)
+	const n = 100
+
+	for i := 0; i < n; i++ {
+		assert.NoError(t, s.Push(storage.URL{Path: fmt.Sprintf("https://www.cdiscount.com/%d", i)}))
+	}
+
+	var (
+		wg    sync.WaitGroup
+		lock  sync.Mutex
+		paths = map[string]int{}
+	)
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				u, err := s.Get()
+				if err != nil {
+					assert.Equal(t, storage.ErrNoURL, err)
+					return
+				}
+				lock.Lock()
+				paths[u.Path]++
+				lock.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	// 每个 url 只会被获取一次
+	assert.Len(t, paths, n)
+	for path, count := range paths {
+		assert.Equal(t, 1, count, path)
+	}
+}
@@ -0,0 +1,891 @@
+package stream
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+
+	"github.com/lack-io/cirrus/config"
+	"github.com/lack-io/cirrus/storage"
+)
+
+const (
+	// prefix redis 键的前缀，不能以 /cirrus/ 开头，否则 redis storage 会把 stream 的键当作命名空间处理
+	prefix = "/cirrus-stream"
+
+	// group 消费者组的名称，所有实例使用同一个消费者组
+	group = "cirrus"
+
+	// pingInterval 检测 redis 状态的时间间隔
+	pingInterval = time.Second * 5
+
+	// reapInterval 检查 pending url 租约的时间间隔
+	reapInterval = time.Second * 5
+
+	// batch 每次读取的 url 个数
+	batch = 1000
+)
+
+// pushScript 添加 url，已经爬取过的 url 返回 0，死信队列中的 url 返回 2，
+// 已经在 stream 中的 url 不会重复添加
+//
+//	KEYS[1]: cook
+//	KEYS[2]: ids
+//	KEYS[3]: dead
+//	KEYS[4]: meta
+//	KEYS[5]: stream
+//	ARGV[1]: url
+//	ARGV[2]: url 信息
+var pushScript = redis.NewScript(`
+if redis.call('HEXISTS', KEYS[1], ARGV[1]) == 1 then
+	return 0
+end
+if redis.call('ZSCORE', KEYS[3], ARGV[1]) then
+	return 2
+end
+if redis.call('HEXISTS', KEYS[2], ARGV[1]) == 1 then
+	return 1
+end
+redis.call('HSET', KEYS[4], ARGV[1], ARGV[2])
+local id = redis.call('XADD', KEYS[5], '*', 'path', ARGV[1])
+redis.call('HSET', KEYS[2], ARGV[1], id)
+return 1
+`)
+
+// deliverScript 检查 stream 中的消息是否仍然有效并返回 url 信息，
+// 被 Restore 或者 Reset 替换的消息会被确认并删除，返回 false
+//
+//	KEYS[1]: stream
+//	KEYS[2]: ids
+//	KEYS[3]: meta
+//	ARGV[1]: url
+//	ARGV[2]: 消息 id
+//	ARGV[3]: 消费者组
+var deliverScript = redis.NewScript(`
+if redis.call('HGET', KEYS[2], ARGV[1]) ~= ARGV[2] then
+	redis.call('XACK', KEYS[1], ARGV[3], ARGV[2])
+	redis.call('XDEL', KEYS[1], ARGV[2])
+	return false
+end
+return redis.call('HGET', KEYS[3], ARGV[1]) or ''
+`)
+
+// failScript 记录 pending 中的 url 爬取失败，确认原来的消息并将 url 重新添加到 stream 的末尾，
+// 达到最大爬取次数时放入死信队列并返回 2。url 为空时从 stream 中读取消息对应的 url
+//
+//	KEYS[1]: stream
+//	KEYS[2]: ids
+//	KEYS[3]: meta
+//	KEYS[4]: dead
+//	ARGV[1]: url
+//	ARGV[2]: 消息 id
+//	ARGV[3]: 失败原因
+//	ARGV[4]: 最大爬取次数
+//	ARGV[5]: 当前时间
+//	ARGV[6]: 消费者组
+var failScript = redis.NewScript(`
+if #redis.call('XPENDING', KEYS[1], ARGV[6], ARGV[2], ARGV[2], 1) == 0 then
+	return 0
+end
+local path = ARGV[1]
+if path == '' then
+	local entries = redis.call('XRANGE', KEYS[1], ARGV[2], ARGV[2])
+	if #entries == 0 then
+		redis.call('XACK', KEYS[1], ARGV[6], ARGV[2])
+		return 0
+	end
+	local fields = entries[1][2]
+	for i = 1, #fields, 2 do
+		if fields[i] == 'path' then
+			path = fields[i + 1]
+		end
+	end
+end
+redis.call('XACK', KEYS[1], ARGV[6], ARGV[2])
+redis.call('XDEL', KEYS[1], ARGV[2])
+if redis.call('HGET', KEYS[2], path) ~= ARGV[2] then
+	return 0
+end
+local url = {path = path}
+local data = redis.call('HGET', KEYS[3], path)
+if data then
+	url = cjson.decode(data)
+end
+url.attempts = (url.attempts or 0) + 1
+if ARGV[3] ~= '' then
+	url.lastError = ARGV[3]
+end
+redis.call('HSET', KEYS[3], path, cjson.encode(url))
+local max = tonumber(ARGV[4])
+if max > 0 and url.attempts >= max then
+	redis.call('HDEL', KEYS[2], path)
+	redis.call('ZADD', KEYS[4], ARGV[5], path)
+	return 2
+end
+local id = redis.call('XADD', KEYS[1], '*', 'path', path)
+redis.call('HSET', KEYS[2], path, id)
+return 1
+`)
+
+// requeueScript 将死信队列中的 url 重新添加到 stream，并清空爬取次数
+//
+//	KEYS[1]: dead
+//	KEYS[2]: meta
+//	KEYS[3]: stream
+//	KEYS[4]: ids
+//	ARGV[1]: url
+var requeueScript = redis.NewScript(`
+if redis.call('ZREM', KEYS[1], ARGV[1]) == 0 then
+	return 0
+end
+local data = redis.call('HGET', KEYS[2], ARGV[1])
+if data then
+	local url = cjson.decode(data)
+	url.attempts = 0
+	redis.call('HSET', KEYS[2], ARGV[1], cjson.encode(url))
+end
+local id = redis.call('XADD', KEYS[3], '*', 'path', ARGV[1])
+redis.call('HSET', KEYS[4], ARGV[1], id)
+return 1
+`)
+
+// recrawlScript 将 recrawl 中到期的 url 重新添加到 stream，并清空爬取次数，返回处理的 url 个数
+//
+//	KEYS[1]: recrawl
+//	KEYS[2]: meta
+//	KEYS[3]: cook
+//	KEYS[4]: stream
+//	KEYS[5]: ids
+//	ARGV[1]: 当前时间
+//	ARGV[2]: 每次处理的 url 个数
+var recrawlScript = redis.NewScript(`
+local paths = redis.call('ZRANGEBYSCORE', KEYS[1], '-inf', ARGV[1], 'LIMIT', 0, ARGV[2])
+for _, path in ipairs(paths) do
+	redis.call('ZREM', KEYS[1], path)
+	local data = redis.call('HGET', KEYS[2], path)
+	if data then
+		local url = cjson.decode(data)
+		url.attempts = nil
+		url.lastError = nil
+		redis.call('HSET', KEYS[2], path, cjson.encode(url))
+	end
+	redis.call('HDEL', KEYS[3], path)
+	if redis.call('HEXISTS', KEYS[5], path) == 0 then
+		local id = redis.call('XADD', KEYS[4], '*', 'path', path)
+		redis.call('HSET', KEYS[5], path, id)
+	end
+end
+return #paths
+`)
+
+// Stream 基于 redis stream 和消费者组的 url 存储。
+// url 按照添加的顺序投递，不支持优先级；已投递但未确认的 url 保存在消费者的 pending 列表中，
+// 租约到期后通过 XCLAIM 回收并重新添加到 stream 的末尾。
+// 爬取过的 url 记录在 cook hash 表中，不支持布隆过滤器
+type Stream struct {
+	// ctx 控制 Stream 的停止
+	ctx context.Context
+
+	opts storage.Options
+
+	// ns 命名空间，所有的 key 都以 /cirrus-stream/<ns> 为前缀
+	ns string
+
+	// consumer 消费者的名称，每个实例不同
+	consumer string
+
+	// cli redis 客户端
+	cli *redis.Client
+
+	// stream redis stream 名称，存储未确认的 url
+	stream string
+
+	// ids redis hash 表名称，存储 url 在 stream 中对应的消息 id
+	ids string
+
+	// meta redis hash 表名称，存储 stream, dead 和 recrawl 中 url 的信息
+	meta string
+
+	// recrawl redis 有序集合的名称，存储需要重新爬取的 url，score 为重新爬取的时间
+	recrawl string
+
+	// dead redis 有序集合的名称，存储超过最大爬取次数的 url，score 为进入死信队列的时间
+	dead string
+
+	// cook redis hash 表名称，存储爬取过的 url 的信息
+	cook string
+
+	ready *atomic.Value
+}
+
+func NewStream(ctx context.Context, cfg *config.StorageRedis, opts storage.Options) *Stream {
+	cli := redis.NewClient(&redis.Options{
+		Addr:         cfg.Addr,
+		Username:     cfg.Username,
+		Password:     cfg.Password,
+		DB:           0,
+		PoolSize:     cfg.Pools,
+		ReadTimeout:  time.Second * 10,
+		WriteTimeout: time.Second * 10,
+	})
+
+	consumer := cfg.Consumer
+	if consumer == "" {
+		host, _ := os.Hostname()
+		consumer = fmt.Sprintf("%s-%d", host, os.Getpid())
+	}
+
+	s := &Stream{
+		ctx:      ctx,
+		opts:     opts,
+		consumer: consumer,
+		cli:      cli,
+		ready:    &atomic.Value{},
+	}
+
+	s.ready.Store(false)
+
+	return s.use(storage.DefaultNamespace)
+}
+
+// use 返回命名空间 ns 中的 Stream，和 s 共享同一个 redis 客户端
+func (s *Stream) use(ns string) *Stream {
+	n := *s
+	n.ns = ns
+	n.stream = path.Join(prefix, ns, "stream")
+	n.ids = path.Join(prefix, ns, "ids")
+	n.meta = path.Join(prefix, ns, "meta")
+	n.recrawl = path.Join(prefix, ns, "recrawl")
+	n.dead = path.Join(prefix, ns, "dead")
+	n.cook = path.Join(prefix, ns, "cook")
+	return &n
+}
+
+func (s *Stream) Init() error {
+	// stream 通过 cook 记录所有爬取过的 url，不支持布隆过滤器
+	if s.opts.Bloom != nil {
+		return fmt.Errorf("%w: stream storage does not support visited = \"bloom\"", storage.ErrStorage)
+	}
+
+	c := s.cli.Ping(s.ctx)
+	if c.Err() != nil {
+		return c.Err()
+	}
+
+	if err := s.createGroup(); err != nil {
+		return err
+	}
+
+	s.ready.Store(true)
+	go s.ping()
+	go s.reap()
+	return nil
+}
+
+func (s *Stream) Namespace(ns string) storage.Storage {
+	if !storage.ValidNamespace(ns) {
+		return storage.Invalid(s, ns)
+	}
+	return s.use(ns)
+}
+
+// createGroup 创建当前命名空间的消费者组，stream 不存在时同时创建 stream
+func (s *Stream) createGroup() error {
+	err := s.cli.XGroupCreateMkStream(s.ctx, s.stream, group, "0").Err()
+	if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		return err
+	}
+	return nil
+}
+
+// isNoGroup 判断错误是否是因为消费者组不存在，Reset 会同时删除 stream 和消费者组
+func isNoGroup(err error) bool {
+	return err != nil && strings.HasPrefix(err.Error(), "NOGROUP")
+}
+
+// nextID 返回 stream 中 id 之后的最小的消息 id，用于分页读取
+func nextID(id string) string {
+	parts := strings.SplitN(id, "-", 2)
+	if len(parts) != 2 {
+		return id
+	}
+	seq, err := strconv.ParseUint(parts[1], 10, 64)
+	if err != nil {
+		return id
+	}
+	return parts[0] + "-" + strconv.FormatUint(seq+1, 10)
+}
+
+func (s *Stream) ping() {
+	timer := time.NewTicker(pingInterval)
+	for {
+		select {
+		case <-s.ctx.Done():
+			timer.Stop()
+			_ = s.cli.Close()
+			return
+		case <-timer.C:
+			c := s.cli.Ping(s.ctx)
+			if c.Err() != nil {
+				s.ready.Store(false)
+			}
+		}
+	}
+}
+
+// reap 回收所有命名空间中租约到期的 url，并将需要重新爬取的 url 重新添加到 stream
+func (s *Stream) reap() {
+	timer := time.NewTicker(reapInterval)
+	for {
+		select {
+		case <-s.ctx.Done():
+			timer.Stop()
+			return
+		case now := <-timer.C:
+			_ = s.expire(now)
+		}
+	}
+}
+
+func (s *Stream) expire(now time.Time) error {
+	if !s.ready.Load().(bool) {
+		return storage.ErrStorage
+	}
+
+	// 通过 stream 和 recrawl 的 key 找到所有需要处理的命名空间
+	namespaces := map[string]struct{}{}
+	for _, name := range []string{"stream", "recrawl"} {
+		iter := s.cli.Scan(s.ctx, 0, path.Join(prefix, "*", name), 0).Iterator()
+		for iter.Next(s.ctx) {
+			// * 也匹配 /，跳过不属于单个命名空间的键
+			ns := strings.TrimSuffix(strings.TrimPrefix(iter.Val(), prefix+"/"), "/"+name)
+			if storage.ValidNamespace(ns) {
+				namespaces[ns] = struct{}{}
+			}
+		}
+		if err := iter.Err(); err != nil {
+			return err
+		}
+	}
+
+	for ns := range namespaces {
+		n := s.use(ns)
+		if err := n.claimNamespace(now); err != nil {
+			return err
+		}
+		if err := n.recrawlNamespace(now); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// claimNamespace 通过 XCLAIM 回收当前命名空间中空闲时间超过租约的 url，
+// 多个实例同时回收时只有一个实例能够成功
+func (s *Stream) claimNamespace(now time.Time) error {
+	start := "-"
+	for {
+		pending, err := s.cli.XPendingExt(s.ctx, &redis.XPendingExtArgs{
+			Stream: s.stream,
+			Group:  group,
+			Start:  start,
+			End:    "+",
+			Count:  batch,
+		}).Result()
+		if isNoGroup(err) || err == redis.Nil {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		ids := make([]string, 0, len(pending))
+		for _, p := range pending {
+			if p.Idle >= s.opts.Lease {
+				ids = append(ids, p.ID)
+			}
+		}
+		if len(ids) > 0 {
+			claimed, err := s.cli.XClaimJustID(s.ctx, &redis.XClaimArgs{
+				Stream:   s.stream,
+				Group:    group,
+				Consumer: s.consumer,
+				MinIdle:  s.opts.Lease,
+				Messages: ids,
+			}).Result()
+			if err != nil {
+				return err
+			}
+			for _, id := range claimed {
+				if _, err = s.fail("", id, storage.ErrLeaseExpired, now); err != nil {
+					return err
+				}
+			}
+		}
+
+		if len(pending) < batch {
+			return nil
+		}
+		start = nextID(pending[len(pending)-1].ID)
+	}
+}
+
+// recrawlNamespace 将当前命名空间中需要重新爬取的 url 重新添加到 stream
+func (s *Stream) recrawlNamespace(now time.Time) error {
+	keys := []string{s.recrawl, s.meta, s.cook, s.stream, s.ids}
+	for {
+		n, err := recrawlScript.Run(s.ctx, s.cli, keys, now.Unix(), batch).Int()
+		if err != nil {
+			return err
+		}
+		if n < batch {
+			return nil
+		}
+	}
+}
+
+// fail 记录消息 id 对应的 url 爬取失败，返回 url 是否进入了死信队列
+func (s *Stream) fail(path, id string, reason error, now time.Time) (bool, error) {
+	var msg string
+	if reason != nil {
+		msg = reason.Error()
+	}
+
+	keys := []string{s.stream, s.ids, s.meta, s.dead}
+	n, err := failScript.Run(s.ctx, s.cli, keys, path, id, msg, s.opts.MaxAttempts, now.Unix(), group).Int()
+	if isNoGroup(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return n == 2, nil
+}
+
+// decode 解析 meta 中存储的 url 信息
+func (s *Stream) decode(path string, data interface{}) *storage.URL {
+	url := &storage.URL{}
+	if v, ok := data.(string); ok && v != "" {
+		_ = json.Unmarshal([]byte(v), url)
+	}
+	url.Path = path
+	url.Storage = s
+	return url
+}
+
+func (s *Stream) Get() (*storage.URL, error) {
+	if !s.ready.Load().(bool) {
+		return nil, storage.ErrStorage
+	}
+
+	for {
+		streams, err := s.cli.XReadGroup(s.ctx, &redis.XReadGroupArgs{
+			Group:    group,
+			Consumer: s.consumer,
+			Streams:  []string{s.stream, ">"},
+			Count:    1,
+			Block:    -1,
+		}).Result()
+		if isNoGroup(err) {
+			if err = s.createGroup(); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if err == redis.Nil {
+			return nil, storage.ErrNoURL
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(streams) == 0 || len(streams[0].Messages) == 0 {
+			return nil, storage.ErrNoURL
+		}
+
+		msg := streams[0].Messages[0]
+		path, _ := msg.Values["path"].(string)
+		keys := []string{s.stream, s.ids, s.meta}
+		data, err := deliverScript.Run(s.ctx, s.cli, keys, path, msg.ID, group).Result()
+		if err == redis.Nil {
+			// 消息已经失效，继续读取下一条消息
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		return s.decode(path, data), nil
+	}
+}
+
+func (s *Stream) Push(url storage.URL) error {
+	if !s.ready.Load().(bool) {
+		return storage.ErrStorage
+	}
+
+	url.Storage = nil
+	data, err := json.Marshal(url)
+	if err != nil {
+		return err
+	}
+
+	keys := []string{s.cook, s.ids, s.dead, s.meta, s.stream}
+	n, err := pushScript.Run(s.ctx, s.cli, keys, url.Path, data).Int()
+	if err != nil {
+		return err
+	}
+	switch n {
+	case 0:
+		return storage.ErrOldURL
+	case 2:
+		return storage.ErrDeadURL
+	}
+	return nil
+}
+
+func (s *Stream) Persist(url storage.URL) error {
+	if !s.ready.Load().(bool) {
+		return storage.ErrStorage
+	}
+
+	id, err := s.cli.HGet(s.ctx, s.ids, url.Path).Result()
+	if err != nil && err != redis.Nil {
+		return err
+	}
+
+	url.Storage = nil
+	url.Attempts, url.LastError = 0, ""
+	url.Fetched = time.Now().Unix()
+	_, err = s.cli.TxPipelined(s.ctx, func(pipe redis.Pipeliner) error {
+		if id != "" {
+			pipe.XAck(s.ctx, s.stream, group, id)
+			pipe.XDel(s.ctx, s.stream, id)
+		}
+		pipe.HDel(s.ctx, s.ids, url.Path)
+		return s.visit(pipe, url)
+	})
+	return err
+}
+
+// visit 记录爬取过的 url，需要重新爬取的 url 同时保存到 recrawl 中
+func (s *Stream) visit(pipe redis.Pipeliner, url storage.URL) error {
+	data, err := json.Marshal(url)
+	if err != nil {
+		return err
+	}
+
+	pipe.HSet(s.ctx, s.cook, url.Path, data)
+
+	due, ok := s.opts.Due(url)
+	if !ok {
+		pipe.HDel(s.ctx, s.meta, url.Path)
+		pipe.ZRem(s.ctx, s.recrawl, url.Path)
+		return nil
+	}
+	pipe.HSet(s.ctx, s.meta, url.Path, data)
+	pipe.ZAdd(s.ctx, s.recrawl, &redis.Z{Score: float64(due.Unix()), Member: url.Path})
+	return nil
+}
+
+func (s *Stream) Nack(url storage.URL, reason error) error {
+	if !s.ready.Load().(bool) {
+		return storage.ErrStorage
+	}
+
+	id, err := s.cli.HGet(s.ctx, s.ids, url.Path).Result()
+	if err == redis.Nil {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	isDead, err := s.fail(url.Path, id, reason, time.Now())
+	if err != nil {
+		return err
+	}
+	if isDead {
+		return storage.ErrDeadURL
+	}
+	return nil
+}
+
+func (s *Stream) Lookup(path string) (*storage.URL, error) {
+	if !s.ready.Load().(bool) {
+		return nil, storage.ErrStorage
+	}
+
+	data, err := s.cli.HGet(s.ctx, s.meta, path).Result()
+	if err == redis.Nil {
+		data, err = s.cli.HGet(s.ctx, s.cook, path).Result()
+	}
+	if err == redis.Nil {
+		return nil, storage.ErrNoURL
+	}
+	if err != nil {
+		return nil, err
+	}
+	return s.decode(path, data), nil
+}
+
+func (s *Stream) Dead() ([]*storage.URL, error) {
+	if !s.ready.Load().(bool) {
+		return nil, storage.ErrStorage
+	}
+
+	paths, err := s.cli.ZRange(s.ctx, s.dead, 0, -1).Result()
+	if err != nil {
+		return nil, err
+	}
+	if len(paths) == 0 {
+		return []*storage.URL{}, nil
+	}
+
+	values, err := s.cli.HMGet(s.ctx, s.meta, paths...).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	urls := make([]*storage.URL, 0, len(paths))
+	for i, path := range paths {
+		urls = append(urls, s.decode(path, values[i]))
+	}
+	return urls, nil
+}
+
+func (s *Stream) Requeue(path string) error {
+	if !s.ready.Load().(bool) {
+		return storage.ErrStorage
+	}
+
+	n, err := requeueScript.Run(s.ctx, s.cli, []string{s.dead, s.meta, s.stream, s.ids}, path).Int()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return fmt.Errorf("%w: %s", storage.ErrNoURL, path)
+	}
+	return nil
+}
+
+func (s *Stream) Snapshot(fn func(*storage.Record) error) error {
+	if !s.ready.Load().(bool) {
+		return storage.ErrStorage
+	}
+
+	if err := s.snapshotStream(fn); err != nil {
+		return err
+	}
+	if err := s.snapshotDead(fn); err != nil {
+		return err
+	}
+	return s.snapshotCook(fn)
+}
+
+// pending 返回当前命名空间中所有已投递未确认的消息 id 和空闲时间
+func (s *Stream) pending() (map[string]time.Duration, error) {
+	idle := map[string]time.Duration{}
+	start := "-"
+	for {
+		pending, err := s.cli.XPendingExt(s.ctx, &redis.XPendingExtArgs{
+			Stream: s.stream,
+			Group:  group,
+			Start:  start,
+			End:    "+",
+			Count:  batch,
+		}).Result()
+		if isNoGroup(err) || err == redis.Nil {
+			return idle, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		for _, p := range pending {
+			idle[p.ID] = p.Idle
+		}
+		if len(pending) < batch {
+			return idle, nil
+		}
+		start = nextID(pending[len(pending)-1].ID)
+	}
+}
+
+// snapshotStream 按照投递顺序导出 stream 中的 url，已投递未确认的 url 导出为 inflight
+func (s *Stream) snapshotStream(fn func(*storage.Record) error) error {
+	idle, err := s.pending()
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	start := "-"
+	for {
+		msgs, err := s.cli.XRangeN(s.ctx, s.stream, start, "+", batch).Result()
+		if err != nil {
+			return err
+		}
+		if len(msgs) == 0 {
+			return nil
+		}
+
+		paths := make([]string, 0, len(msgs))
+		for _, msg := range msgs {
+			path, _ := msg.Values["path"].(string)
+			paths = append(paths, path)
+		}
+		ids, err := s.cli.HMGet(s.ctx, s.ids, paths...).Result()
+		if err != nil {
+			return err
+		}
+		values, err := s.cli.HMGet(s.ctx, s.meta, paths...).Result()
+		if err != nil {
+			return err
+		}
+
+		for i, msg := range msgs {
+			// 跳过已经失效的消息
+			if id, _ := ids[i].(string); id != msg.ID {
+				continue
+			}
+			record := &storage.Record{URL: *s.decode(paths[i], values[i]), State: storage.StateRaw}
+			record.Storage = nil
+			if d, ok := idle[msg.ID]; ok {
+				record.State = storage.StateInflight
+				record.Deadline = now.Add(s.opts.Lease - d).Unix()
+			}
+			if err = fn(record); err != nil {
+				return err
+			}
+		}
+		start = nextID(msgs[len(msgs)-1].ID)
+	}
+}
+
+// snapshotDead 导出死信队列中的 url
+func (s *Stream) snapshotDead(fn func(*storage.Record) error) error {
+	for start := int64(0); ; start += batch {
+		paths, err := s.cli.ZRange(s.ctx, s.dead, start, start+batch-1).Result()
+		if err != nil {
+			return err
+		}
+		if len(paths) == 0 {
+			return nil
+		}
+
+		values, err := s.cli.HMGet(s.ctx, s.meta, paths...).Result()
+		if err != nil {
+			return err
+		}
+		for i, path := range paths {
+			record := &storage.Record{URL: *s.decode(path, values[i]), State: storage.StateDead}
+			record.Storage = nil
+			if err = fn(record); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// snapshotCook 导出爬取过的 url，需要重新爬取的 url 以 meta 中的信息为准
+func (s *Stream) snapshotCook(fn func(*storage.Record) error) error {
+	var cursor uint64
+	for {
+		keys, next, err := s.cli.HScan(s.ctx, s.cook, cursor, "", batch).Result()
+		if err != nil {
+			return err
+		}
+
+		// HSCAN 返回 field 和 value 交替的列表
+		paths := make([]string, 0, len(keys)/2)
+		for i := 0; i < len(keys); i += 2 {
+			paths = append(paths, keys[i])
+		}
+		var values []interface{}
+		if len(paths) > 0 {
+			if values, err = s.cli.HMGet(s.ctx, s.meta, paths...).Result(); err != nil {
+				return err
+			}
+		}
+
+		for i, path := range paths {
+			data := values[i]
+			if data == nil {
+				data = keys[i*2+1]
+			}
+			record := &storage.Record{URL: *s.decode(path, data), State: storage.StateCook}
+			record.Storage = nil
+			if err = fn(record); err != nil {
+				return err
+			}
+		}
+		if next == 0 {
+			return nil
+		}
+		cursor = next
+	}
+}
+
+func (s *Stream) Restore(record *storage.Record) error {
+	if !s.ready.Load().(bool) {
+		return storage.ErrStorage
+	}
+
+	// Stream 不使用布隆过滤器，无法导入 bitmap
+	if record.State == storage.StateVisited {
+		return fmt.Errorf("%w: unsupported state %q", storage.ErrSnapshot, record.State)
+	}
+
+	url := record.URL
+	url.Storage = nil
+	data, err := json.Marshal(url)
+	if err != nil {
+		return err
+	}
+
+	id, err := s.cli.HGet(s.ctx, s.ids, url.Path).Result()
+	if err != nil && err != redis.Nil {
+		return err
+	}
+
+	_, err = s.cli.TxPipelined(s.ctx, func(pipe redis.Pipeliner) error {
+		if id != "" {
+			pipe.XAck(s.ctx, s.stream, group, id)
+			pipe.XDel(s.ctx, s.stream, id)
+		}
+		pipe.HDel(s.ctx, s.ids, url.Path)
+		pipe.ZRem(s.ctx, s.dead, url.Path)
+		pipe.ZRem(s.ctx, s.recrawl, url.Path)
+		pipe.HDel(s.ctx, s.cook, url.Path)
+
+		switch record.State {
+		case storage.StateDead:
+			pipe.HSet(s.ctx, s.meta, url.Path, data)
+			pipe.ZAdd(s.ctx, s.dead, &redis.Z{Score: float64(time.Now().Unix()), Member: url.Path})
+		case storage.StateCook:
+			if url.Fetched == 0 {
+				url.Fetched = time.Now().Unix()
+			}
+			return s.visit(pipe, url)
+		}
+		return nil
+	})
+	if err != nil || (record.State != storage.StateRaw && record.State != storage.StateInflight) {
+		return err
+	}
+
+	// inflight 的 url 导入后重新投递
+	keys := []string{s.cook, s.ids, s.dead, s.meta, s.stream}
+	return pushScript.Run(s.ctx, s.cli, keys, url.Path, data).Err()
+}
+
+func (s *Stream) Reset() {
+	// 清除当前命名空间中的所有 url，消费者组随 stream 一起删除，不影响其他命名空间
+	s.cli.Del(s.ctx, s.stream, s.ids, s.meta, s.dead, s.recrawl, s.cook)
+}
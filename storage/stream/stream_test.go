@@ -0,0 +1,284 @@
+package stream
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/lack-io/cirrus/config"
+	"github.com/lack-io/cirrus/storage"
+	"github.com/lack-io/cirrus/storage/storagetest"
+)
+
+// newStream 设置了 CIRRUS_TEST_REDIS 时使用该地址的 redis-server，否则使用 miniredis
+func newStream(t *testing.T, opts storage.Options) *Stream {
+	addr := os.Getenv("CIRRUS_TEST_REDIS")
+	if addr == "" {
+		addr = miniredis.RunT(t).Addr()
+	}
+
+	s := NewStream(context.Background(), &config.StorageRedis{Addr: addr, Pools: 2, Consumer: "test"}, opts)
+	if err := s.Init(); err != nil {
+		t.Fatal(err)
+	}
+	s.Reset()
+	t.Cleanup(s.Reset)
+	return s
+}
+
+func TestStream_Get(t *testing.T) {
+	s := newStream(t, storage.Options{Lease: time.Minute})
+
+	_, err := s.Get()
+	assert.Equal(t, storage.ErrNoURL, err)
+
+	// 按照添加的顺序投递
+	paths := []string{"https://www.cdiscount.com/a", "https://www.cdiscount.com/b", "https://www.cdiscount.com/c"}
+	for _, path := range paths {
+		assert.NoError(t, s.Push(storage.URL{Path: path, Kind: "link", Depth: 1}))
+	}
+	assert.NoError(t, s.Push(storage.URL{Path: paths[0]}))
+
+	for _, path := range paths {
+		url, err := s.Get()
+		if !assert.NoError(t, err) {
+			return
+		}
+		assert.Equal(t, path, url.Path)
+		assert.Equal(t, "link", url.Kind)
+		assert.Equal(t, 1, url.Depth)
+		assert.Equal(t, s, url.Storage)
+	}
+
+	_, err = s.Get()
+	assert.Equal(t, storage.ErrNoURL, err)
+
+	// 正在爬取的 url 不会重复添加
+	assert.NoError(t, s.Push(storage.URL{Path: paths[0]}))
+	_, err = s.Get()
+	assert.Equal(t, storage.ErrNoURL, err)
+}
+
+func TestStream_Persist(t *testing.T) {
+	s := newStream(t, storage.Options{Lease: time.Minute})
+	path := "https://www.cdiscount.com"
+
+	assert.NoError(t, s.Push(storage.URL{Path: path}))
+	url, err := s.Get()
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.NoError(t, url.Storage.Persist(*url))
+	assert.Equal(t, storage.ErrOldURL, s.Push(storage.URL{Path: path}))
+
+	n, err := s.cli.XLen(s.ctx, s.stream).Result()
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), n)
+
+	found, err := s.Lookup(path)
+	if assert.NoError(t, err) {
+		assert.NotZero(t, found.Fetched)
+	}
+}
+
+func TestStream_Nack(t *testing.T) {
+	s := newStream(t, storage.Options{Lease: time.Minute, MaxAttempts: 2})
+	path := "https://www.cdiscount.com"
+	reason := errors.New("timeout")
+
+	// 没有被投递的 url 不会被记录失败
+	assert.NoError(t, s.Nack(storage.URL{Path: path}, reason))
+
+	assert.NoError(t, s.Push(storage.URL{Path: path}))
+	url, err := s.Get()
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.NoError(t, s.Nack(*url, reason))
+
+	url, err = s.Get()
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, 1, url.Attempts)
+	assert.Equal(t, "timeout", url.LastError)
+
+	assert.Equal(t, storage.ErrDeadURL, s.Nack(*url, reason))
+	_, err = s.Get()
+	assert.Equal(t, storage.ErrNoURL, err)
+	assert.Equal(t, storage.ErrDeadURL, s.Push(storage.URL{Path: path}))
+
+	dead, err := s.Dead()
+	if assert.NoError(t, err) && assert.Len(t, dead, 1) {
+		assert.Equal(t, path, dead[0].Path)
+		assert.Equal(t, 2, dead[0].Attempts)
+	}
+
+	assert.NoError(t, s.Requeue(path))
+	assert.True(t, errors.Is(s.Requeue(path), storage.ErrNoURL))
+	url, err = s.Get()
+	if assert.NoError(t, err) {
+		assert.Equal(t, path, url.Path)
+		assert.Equal(t, 0, url.Attempts)
+	}
+}
+
+func TestStream_Expire(t *testing.T) {
+	s := newStream(t, storage.Options{Lease: time.Millisecond * 50, MaxAttempts: 2})
+	path := "https://www.cdiscount.com"
+
+	assert.NoError(t, s.Push(storage.URL{Path: path}))
+	_, err := s.Get()
+	assert.NoError(t, err)
+
+	// 租约未到期的 url 不会被回收
+	assert.NoError(t, s.expire(time.Now()))
+	_, err = s.Get()
+	assert.Equal(t, storage.ErrNoURL, err)
+
+	time.Sleep(time.Millisecond * 100)
+	assert.NoError(t, s.expire(time.Now()))
+	url, err := s.Get()
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, path, url.Path)
+	assert.Equal(t, 1, url.Attempts)
+	assert.Equal(t, storage.ErrLeaseExpired.Error(), url.LastError)
+
+	time.Sleep(time.Millisecond * 100)
+	assert.NoError(t, s.expire(time.Now()))
+	_, err = s.Get()
+	assert.Equal(t, storage.ErrNoURL, err)
+
+	dead, err := s.Dead()
+	if assert.NoError(t, err) {
+		assert.Len(t, dead, 1)
+	}
+}
+
+func TestStream_Recrawl(t *testing.T) {
+	s := newStream(t, storage.Options{Lease: time.Minute, Recrawl: map[string]time.Duration{"link": time.Hour}})
+	link, group := "https://www.cdiscount.com/f-1", "https://www.cdiscount.com/g-1"
+
+	assert.NoError(t, s.Push(storage.URL{Path: link, Kind: "link"}))
+	assert.NoError(t, s.Push(storage.URL{Path: group, Kind: "group"}))
+	for i := 0; i < 2; i++ {
+		url, err := s.Get()
+		if !assert.NoError(t, err) {
+			return
+		}
+		assert.NoError(t, s.Persist(*url))
+	}
+
+	assert.NoError(t, s.expire(time.Now()))
+	_, err := s.Get()
+	assert.Equal(t, storage.ErrNoURL, err)
+
+	assert.NoError(t, s.expire(time.Now().Add(time.Hour*2)))
+	url, err := s.Get()
+	if assert.NoError(t, err) {
+		assert.Equal(t, link, url.Path)
+	}
+	_, err = s.Get()
+	assert.Equal(t, storage.ErrNoURL, err)
+	assert.Equal(t, storage.ErrOldURL, s.Push(storage.URL{Path: group}))
+}
+
+func TestStream_Namespace(t *testing.T) {
+	s := newStream(t, storage.Options{Lease: time.Minute})
+	a, b := s.Namespace("a"), s.Namespace("b")
+	defer a.Reset()
+	defer b.Reset()
+	path := "https://www.cdiscount.com"
+
+	assert.NoError(t, a.Push(storage.URL{Path: path}))
+	url, err := a.Get()
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.NoError(t, url.Storage.Persist(*url))
+	assert.Equal(t, storage.ErrOldURL, a.Push(storage.URL{Path: path}))
+	assert.NoError(t, b.Push(storage.URL{Path: path}))
+
+	// Reset 删除消费者组后仍然可以继续使用
+	a.Reset()
+	assert.NoError(t, a.Push(storage.URL{Path: path}))
+	url, err = a.Get()
+	if assert.NoError(t, err) {
+		assert.Equal(t, path, url.Path)
+	}
+	url, err = b.Get()
+	if assert.NoError(t, err) {
+		assert.Equal(t, path, url.Path)
+	}
+}
+
+func TestStream_Snapshot(t *testing.T) {
+	s := newStream(t, storage.Options{Lease: time.Minute, MaxAttempts: 1})
+	urls := []storage.URL{
+		{Path: "https://www.cdiscount.com/a", Kind: "link"},
+		{Path: "https://www.cdiscount.com/b", Kind: "link"},
+		{Path: "https://www.cdiscount.com/c", Kind: "group"},
+		{Path: "https://www.cdiscount.com/d", Kind: "group"},
+	}
+	for _, url := range urls {
+		assert.NoError(t, s.Push(url))
+	}
+	a, _ := s.Get()
+	assert.NoError(t, s.Persist(*a))
+	b, _ := s.Get()
+	assert.Equal(t, storage.ErrDeadURL, s.Nack(*b, errors.New("timeout")))
+	_, _ = s.Get()
+
+	states := map[string]storage.State{}
+	var records []*storage.Record
+	assert.NoError(t, s.Snapshot(func(r *storage.Record) error {
+		states[r.Path] = r.State
+		records = append(records, r)
+		return nil
+	}))
+	assert.Equal(t, map[string]storage.State{
+		urls[0].Path: storage.StateCook,
+		urls[1].Path: storage.StateDead,
+		urls[2].Path: storage.StateInflight,
+		urls[3].Path: storage.StateRaw,
+	}, states)
+
+	n := s.Namespace("restore").(*Stream)
+	defer n.Reset()
+	for _, r := range records {
+		assert.NoError(t, n.Restore(r))
+	}
+	assert.True(t, errors.Is(n.Restore(&storage.Record{State: storage.StateVisited}), storage.ErrSnapshot))
+
+	assert.Equal(t, storage.ErrOldURL, n.Push(urls[0]))
+	assert.Equal(t, storage.ErrDeadURL, n.Push(urls[1]))
+	for _, path := range []string{urls[2].Path, urls[3].Path} {
+		url, err := n.Get()
+		if assert.NoError(t, err) {
+			assert.Equal(t, path, url.Path)
+		}
+	}
+	_, err := n.Get()
+	assert.Equal(t, storage.ErrNoURL, err)
+}
+
+func TestStream_Bloom(t *testing.T) {
+	opts := storage.Options{Bloom: &storage.BloomOptions{Capacity: 10000, FPRate: 0.001}}
+	s := NewStream(context.Background(), &config.StorageRedis{Addr: miniredis.RunT(t).Addr(), Pools: 2}, opts)
+	assert.True(t, errors.Is(s.Init(), storage.ErrStorage))
+}
+
+func TestStream_Conformance(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T, opts storage.Options) storage.Storage {
+		ctx, cancel := context.WithCancel(context.Background())
+		t.Cleanup(cancel)
+		return NewStream(ctx, &config.StorageRedis{Addr: miniredis.RunT(t).Addr(), Pools: 2, Consumer: "test"}, opts)
+	})
+}
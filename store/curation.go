@@ -0,0 +1,137 @@
+package store
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// State 宝贝的审核状态
+type State string
+
+const (
+	// StateNew 未审核的宝贝
+	StateNew State = "new"
+	// StateShortlisted 准备上架的宝贝
+	StateShortlisted State = "shortlisted"
+	// StateRejected 不上架的宝贝
+	StateRejected State = "rejected"
+	// StateListed 已经上架的宝贝
+	StateListed State = "listed"
+)
+
+// ParseState 解析审核状态，未知的状态返回 ErrInvalidQuery
+func ParseState(s string) (State, error) {
+	switch state := State(strings.ToLower(strings.TrimSpace(s))); state {
+	case StateNew, StateShortlisted, StateRejected, StateListed:
+		return state, nil
+	default:
+		return "", fmt.Errorf("%w: unknown state %q", ErrInvalidQuery, s)
+	}
+}
+
+// Tags 审核标签，与 Chain 一样以 JSON 数组的格式保存到数据库
+type Tags []string
+
+func (t Tags) Value() (driver.Value, error) {
+	return Chain(t).Value()
+}
+
+func (t *Tags) Scan(v interface{}) error {
+	return (*Chain)(t).Scan(v)
+}
+
+// normalize 去掉标签两端的空白、空标签和重复的标签，并按照字母顺序排序
+func (t Tags) normalize() Tags {
+	seen := map[string]bool{}
+	tags := make(Tags, 0, len(t))
+	for _, tag := range t {
+		tag = strings.TrimSpace(tag)
+		if tag == "" || seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		tags = append(tags, tag)
+	}
+	sort.Strings(tags)
+	return tags
+}
+
+// Patch 修改宝贝的审核信息，为 nil 的字段不修改
+type Patch struct {
+	State *State `json:"state"`
+
+	Notes *string `json:"notes"`
+
+	Tags *Tags `json:"tags"`
+
+	// Reviewer 修改审核信息的人
+	Reviewer string `json:"reviewer"`
+}
+
+// updates 返回 patch 需要修改的列，state 无效时返回 ErrInvalidQuery
+func (p *Patch) updates() (map[string]interface{}, error) {
+	updates := map[string]interface{}{}
+	if p.State != nil {
+		state, err := ParseState(string(*p.State))
+		if err != nil {
+			return nil, err
+		}
+		updates["state"] = state
+	}
+	if p.Notes != nil {
+		updates["notes"] = *p.Notes
+	}
+	if p.Tags != nil {
+		updates["tags"] = p.Tags.normalize()
+	}
+	if len(updates) == 0 {
+		return nil, fmt.Errorf("%w: nothing to update", ErrInvalidQuery)
+	}
+	updates["reviewer"] = p.Reviewer
+	updates["reviewed_at"] = time.Now().Unix()
+	return updates, nil
+}
+
+func (s *DB) UpdateGood(id int64, patch *Patch) (*Good, error) {
+	updates, err := patch.updates()
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.db.Table("goods").Where("id = ?", id).Updates(updates).Error
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrDBWrite, err)
+	}
+
+	goods := make([]*Good, 0)
+	if err = s.db.Table("goods").Where("id = ?", id).Limit(1).Find(&goods).Error; err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrDBRead, err)
+	}
+	if len(goods) == 0 {
+		return nil, fmt.Errorf("%w: %d", ErrNotFound, id)
+	}
+	return goods[0], nil
+}
+
+func (s *DB) SetGoodsState(f *Filter, state State, reviewer string) (int64, error) {
+	state, err := ParseState(string(state))
+	if err != nil {
+		return 0, err
+	}
+	if !f.restricted() {
+		return 0, fmt.Errorf("%w: empty filter", ErrInvalidQuery)
+	}
+
+	tx := where(s.db.Table("goods"), f).Updates(map[string]interface{}{
+		"state":       state,
+		"reviewer":    reviewer,
+		"reviewed_at": time.Now().Unix(),
+	})
+	if tx.Error != nil {
+		return 0, fmt.Errorf("%w: %v", ErrDBWrite, tx.Error)
+	}
+	return tx.RowsAffected, nil
+}
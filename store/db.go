@@ -0,0 +1,306 @@
+package store
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/logger"
+)
+
+// mutableColumns 再次爬取到宝贝时需要更新的字段
+var mutableColumns = []string{
+	"url", "scaleout", "brandless", "comments", "express", "timestamp",
+	"depth", "parent", "provenance", "last_seen",
+	"title", "price", "currency", "seller", "category", "rating", "image", "ean",
+}
+
+// DB 使用 gorm 访问数据库的 Store，sqlite 和 postgres 共用
+type DB struct {
+	db *gorm.DB
+
+	// searcher 数据库对应的全文搜索实现
+	searcher searcher
+}
+
+// connect 连接数据库
+func connect(dialector gorm.Dialector) (*gorm.DB, error) {
+	db, err := gorm.Open(dialector, &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrConnectDB, err)
+	}
+
+	sqlDB, err := db.DB()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrConnectDB, err)
+	}
+
+	sqlDB.SetConnMaxLifetime(time.Second * 5)
+	sqlDB.SetMaxIdleConns(50)
+	sqlDB.SetMaxOpenConns(10)
+
+	return db, nil
+}
+
+// open 连接数据库并将表结构迁移到最新的版本，数据库的版本比程序新时返回 ErrSchemaAhead
+func open(dialector gorm.Dialector) (*DB, error) {
+	db, err := connect(dialector)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = (&Migrator{db: db}).Up(0); err != nil {
+		return nil, err
+	}
+
+	// 编译时是否使用 sqlite_fts5 标签会影响 sqlite 的全文索引，每次启动都需要检查
+	searcher := searcherFor(db)
+	if err = searcher.init(db); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrDBWrite, err)
+	}
+
+	return &DB{db: db, searcher: searcher}, nil
+}
+
+// where 添加 f 对应的查询条件
+func where(db *gorm.DB, f *Filter) *gorm.DB {
+	// 默认只查询没有被删除的宝贝
+	if f != nil && f.Deleted {
+		db = db.Where("goods.deleted_at > 0")
+	} else {
+		db = db.Where("goods.deleted_at = 0")
+	}
+	if f == nil {
+		return db
+	}
+
+	if f.Latest {
+		db = db.Where("goods.latest = ?", true)
+	}
+	if f.Start > 0 {
+		db = db.Where("goods.timestamp > ?", f.Start)
+	}
+	if f.End > 0 {
+		db = db.Where("goods.timestamp < ?", f.End)
+	}
+	if f.Brandless != nil {
+		db = db.Where("goods.brandless = ?", *f.Brandless)
+	}
+	if f.ScaleOut != nil {
+		db = db.Where("goods.scaleout = ?", *f.ScaleOut)
+	}
+	if f.MinComments != nil {
+		db = db.Where("goods.comments >= ?", *f.MinComments)
+	}
+	if f.MaxComments != nil {
+		db = db.Where("goods.comments <= ?", *f.MaxComments)
+	}
+	if f.Express != "" {
+		db = db.Where("goods.express = ?", f.Express)
+	}
+	if f.ExpressLike != "" {
+		db = db.Where(`LOWER(goods.express) LIKE ? ESCAPE '\'`, "%"+like(strings.ToLower(f.ExpressLike))+"%")
+	}
+	if f.Category != "" {
+		db = db.Where(`(goods.category = ? OR goods.category LIKE ? ESCAPE '\')`, f.Category, like(f.Category)+" > %")
+	}
+	if f.MinPrice != nil {
+		db = db.Where("goods.price >= ?", *f.MinPrice)
+	}
+	if f.MaxPrice != nil {
+		db = db.Where("goods.price <= ?", *f.MaxPrice)
+	}
+	if len(f.IDs) > 0 {
+		db = db.Where("goods.id IN ?", f.IDs)
+	}
+	if len(f.States) > 0 {
+		db = db.Where("goods.state IN ?", f.States)
+	}
+	if f.Tag != "" {
+		// 标签以 JSON 数组保存，匹配带引号的标签
+		tag, _ := json.Marshal(f.Tag)
+		db = db.Where(`goods.tags LIKE ? ESCAPE '\'`, "%"+like(string(tag))+"%")
+	}
+	if f.Reviewer != "" {
+		db = db.Where("goods.reviewer = ?", f.Reviewer)
+	}
+	return db
+}
+
+// like 转义 LIKE 中的通配符
+func like(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s)
+}
+
+// order 按照 f.Sort 排序，f.Sort 为空时使用 defaults 排序，最后按照 ID 排序保证分页的结果稳定
+func order(db *gorm.DB, f *Filter, defaults ...string) (*gorm.DB, error) {
+	var sorts []Sort
+	if f != nil {
+		sorts = f.Sort
+	}
+	if len(sorts) == 0 {
+		for _, d := range defaults {
+			db = db.Order(d)
+		}
+	}
+	for _, sort := range sorts {
+		column, ok := sortColumns[sort.Field]
+		if !ok {
+			return nil, fmt.Errorf("%w: unknown sort field %q", ErrInvalidQuery, sort.Field)
+		}
+		db = db.Order(clause.OrderByColumn{Column: clause.Column{Table: "goods", Name: column}, Desc: sort.Desc})
+	}
+	return db.Order("goods.id desc"), nil
+}
+
+// find 按照 f.Sort 或者入库时间倒序查询满足 f 的宝贝
+func find(db *gorm.DB, f *Filter, pg *Pagination) ([]*Good, error) {
+	goods := make([]*Good, 0)
+
+	db, err := order(where(db, f), f, "goods.timestamp desc")
+	if err != nil {
+		return nil, err
+	}
+	if pg != nil {
+		if err := db.Count(&pg.Total).Error; err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrDBRead, err)
+		}
+		db = db.Limit(pg.Size).Offset((pg.Page - 1) * pg.Size)
+	}
+
+	err = db.Find(&goods).Error
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrDBRead, err)
+	}
+
+	return goods, nil
+}
+
+func (s *DB) GetGoods(f *Filter, pg *Pagination) ([]*Good, error) {
+	return find(s.db.Table("goods"), f, pg)
+}
+
+func (s *DB) WalkGoods(q string, f *Filter, fn func(good *Good) error) error {
+	var (
+		db  *gorm.DB
+		err error
+	)
+	if q == "" {
+		db, err = order(where(s.db.Table("goods"), f), f, "goods.timestamp desc")
+	} else if db, err = s.search(q, f); err == nil {
+		db = db.Select(s.searcher.columns())
+	}
+	if err != nil {
+		return err
+	}
+
+	rows, err := db.Rows()
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrDBRead, err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		row := &hit{}
+		if err = db.ScanRows(rows, row); err != nil {
+			return fmt.Errorf("%w: %v", ErrDBRead, err)
+		}
+		if err = fn(&row.Good); err != nil {
+			return err
+		}
+	}
+	if err = rows.Err(); err != nil {
+		return fmt.Errorf("%w: %v", ErrDBRead, err)
+	}
+	return nil
+}
+
+func (s *DB) GetGoodsByTimeout(start, end int64, f *Filter, pg *Pagination) ([]*Good, error) {
+	return find(s.db.Table("goods").Where("timestamp > ? AND timestamp < ?", start, end), f, pg)
+}
+
+func (s *DB) GetGoodByUID(uid string) (*Good, error) {
+	goods := make([]*Good, 0)
+	err := s.db.Table("goods").Where("uid = ? AND deleted_at = 0", uid).Order("latest desc, timestamp desc").Limit(1).Find(&goods).Error
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrDBRead, err)
+	}
+	if len(goods) == 0 {
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, uid)
+	}
+	return goods[0], nil
+}
+
+func (s *DB) AddGood(good *Good) error {
+	if good.Timestamp == 0 {
+		good.Timestamp = time.Now().Unix()
+	}
+	good.FirstSeen, good.LastSeen, good.Latest = good.Timestamp, good.Timestamp, true
+
+	// 删除的宝贝留有墓碑，不会再次保存
+	var deleted int64
+	err := s.db.Table("tombstones").Where("uid = ?", good.UID).Count(&deleted).Error
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrDBRead, err)
+	}
+	if deleted > 0 {
+		return fmt.Errorf("%w: %s", ErrDeleted, good.UID)
+	}
+
+	err = s.db.Table("goods").Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "uid"}},
+		Where:     clause.Where{Exprs: []clause.Expression{clause.Expr{SQL: "latest = true"}}},
+		DoUpdates: clause.AssignmentColumns(mutableColumns),
+	}).Create(good).Error
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrDBWrite, err)
+	}
+
+	// 更新已有的宝贝时需要读取宝贝的 ID 和第一次爬取的时间
+	saved := &Good{}
+	err = s.db.Table("goods").Select("id", "first_seen").
+		Where("uid = ? AND latest = ?", good.UID, true).Take(saved).Error
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrDBRead, err)
+	}
+	good.ID, good.FirstSeen = saved.ID, saved.FirstSeen
+
+	return nil
+}
+
+func (s *DB) AddObservation(o *Observation) error {
+	if o.Timestamp == 0 {
+		o.Timestamp = time.Now().Unix()
+	}
+
+	err := s.db.Table("observations").Create(o).Error
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrDBWrite, err)
+	}
+
+	return nil
+}
+
+func (s *DB) GetObservations(uid string, start, end int64) ([]*Observation, error) {
+	observations := make([]*Observation, 0)
+
+	db := s.db.Table("observations").Where("uid = ? AND timestamp >= ?", uid, start)
+	if end > 0 {
+		db = db.Where("timestamp <= ?", end)
+	}
+	err := db.Order("timestamp, id").Find(&observations).Error
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrDBRead, err)
+	}
+
+	return observations, nil
+}
+
+func (s *DB) Reset() {
+
+}
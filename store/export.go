@@ -0,0 +1,148 @@
+package store
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/lack-io/cirrus/internal/xlsx"
+)
+
+// Format 导出宝贝的文件格式
+type Format string
+
+const (
+	CSV   Format = "csv"
+	XLSX  Format = "xlsx"
+	JSONL Format = "jsonl"
+)
+
+// ParseFormat 解析导出的文件格式，不支持的格式返回 ErrInvalidQuery
+func ParseFormat(s string) (Format, error) {
+	switch f := Format(strings.ToLower(s)); f {
+	case CSV, XLSX, JSONL:
+		return f, nil
+	default:
+		return "", fmt.Errorf("%w: unknown export format %q", ErrInvalidQuery, s)
+	}
+}
+
+// ContentType 返回文件格式对应的 MIME 类型
+func (f Format) ContentType() string {
+	switch f {
+	case CSV:
+		return "text/csv; charset=utf-8"
+	case XLSX:
+		return "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+	default:
+		return "application/x-ndjson"
+	}
+}
+
+// columns 导出为表格时的列，JSONL 导出宝贝的所有字段
+var columns = []string{
+	"id", "uid", "url", "title", "price", "currency", "seller", "express", "category", "rating", "comments",
+	"scaleOut", "brandless", "ean", "image", "depth", "parent", "timestamp", "firstSeen", "lastSeen", "latest",
+	"state", "tags", "notes", "reviewer", "reviewedAt",
+}
+
+// row 返回宝贝在表格中的一行，顺序与 columns 一致
+func row(g *Good) []interface{} {
+	return []interface{}{
+		g.ID, g.UID, g.URL, g.Title, g.Price, g.Currency, g.Seller, g.Express, g.Category, g.Rating, g.Comments,
+		g.ScaleOut, g.Brandless, g.EAN, g.Image, g.Depth, g.Parent, g.Timestamp, g.FirstSeen, g.LastSeen, g.Latest,
+		string(g.State), strings.Join(g.Tags, ", "), g.Notes, g.Reviewer, g.ReviewedAt,
+	}
+}
+
+// encoder 将宝贝写入导出的文件
+type encoder interface {
+	encode(g *Good) error
+	close() error
+}
+
+type jsonlEncoder struct {
+	enc *json.Encoder
+}
+
+func (e *jsonlEncoder) encode(g *Good) error { return e.enc.Encode(g) }
+
+func (e *jsonlEncoder) close() error { return nil }
+
+type csvEncoder struct {
+	w *csv.Writer
+}
+
+func (e *csvEncoder) encode(g *Good) error {
+	record := make([]string, 0, len(columns))
+	for _, v := range row(g) {
+		record = append(record, cell(fmt.Sprint(v)))
+	}
+	return e.w.Write(record)
+}
+
+func (e *csvEncoder) close() error {
+	e.w.Flush()
+	return e.w.Error()
+}
+
+// cell 在以 = + - @ 开头的文本前添加单引号，避免表格软件将单元格当作公式执行
+func cell(s string) string {
+	if s != "" && strings.ContainsRune("=+-@", rune(s[0])) {
+		return "'" + s
+	}
+	return s
+}
+
+type xlsxEncoder struct {
+	w *xlsx.Writer
+}
+
+func (e *xlsxEncoder) encode(g *Good) error { return e.w.Write(row(g)) }
+
+func (e *xlsxEncoder) close() error { return e.w.Close() }
+
+// Export 将 s 中全文搜索 q (可以为空) 并且满足 f 的宝贝以 format 格式写入 w，返回写入的宝贝个数。
+// 宝贝从数据库中逐个读取并写入，不会将所有的宝贝读取到内存中
+func Export(s Store, w io.Writer, format Format, q string, f *Filter) (int, error) {
+	var (
+		enc encoder
+		err error
+	)
+	switch format {
+	case JSONL:
+		enc = &jsonlEncoder{enc: json.NewEncoder(w)}
+	case CSV:
+		cw := csv.NewWriter(w)
+		err = cw.Write(columns)
+		enc = &csvEncoder{w: cw}
+	case XLSX:
+		xw := xlsx.NewWriter(w, "goods")
+		header := make([]interface{}, 0, len(columns))
+		for _, c := range columns {
+			header = append(header, c)
+		}
+		err = xw.Write(header)
+		enc = &xlsxEncoder{w: xw}
+	default:
+		return 0, fmt.Errorf("%w: unknown export format %q", ErrInvalidQuery, format)
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	n := 0
+	err = s.WalkGoods(q, f, func(g *Good) error {
+		if err := enc.encode(g); err != nil {
+			return err
+		}
+		n++
+		return nil
+	})
+	if cerr := enc.close(); err == nil {
+		err = cerr
+	}
+	return n, err
+}
@@ -0,0 +1,80 @@
+package store
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/lack-io/cirrus/config"
+)
+
+func TestExport(t *testing.T) {
+	s, err := NewSqlite(&config.DBSqlite{Name: filepath.Join(t.TempDir(), "cirrus.db")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, title := range []string{"=HYPERLINK(\"x\")", "Clavier Logitech", "Casque"} {
+		assert.NoError(t, s.AddGood(&Good{UID: string(rune('a' + i)), Title: title, Price: float64(i), Timestamp: int64(100 + i)}))
+	}
+	filter := &Filter{Sort: []Sort{{Field: "price"}}}
+
+	buf := bytes.NewBuffer(nil)
+	n, err := Export(s, buf, CSV, "", filter)
+	if assert.NoError(t, err) {
+		assert.Equal(t, 3, n)
+		records, err := csv.NewReader(buf).ReadAll()
+		if assert.NoError(t, err) && assert.Len(t, records, 4) {
+			assert.Equal(t, columns, records[0])
+			assert.Equal(t, "a", records[1][1])
+			// 公式不会被表格软件执行
+			assert.Equal(t, "'=HYPERLINK(\"x\")", records[1][3])
+		}
+	}
+
+	buf.Reset()
+	n, err = Export(s, buf, JSONL, "logitech", nil)
+	if assert.NoError(t, err) && assert.Equal(t, 1, n) {
+		good := &Good{}
+		assert.NoError(t, json.NewDecoder(buf).Decode(good))
+		assert.Equal(t, "b", good.UID)
+	}
+
+	buf.Reset()
+	n, err = Export(s, buf, XLSX, "", &Filter{Start: 100})
+	if assert.NoError(t, err) && assert.Equal(t, 2, n) {
+		r, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+		if assert.NoError(t, err) {
+			names := make([]string, 0)
+			for _, f := range r.File {
+				names = append(names, f.Name)
+			}
+			assert.Contains(t, names, "xl/worksheets/sheet1.xml")
+		}
+	}
+
+	_, err = Export(s, buf, Format("pdf"), "", nil)
+	assert.True(t, errors.Is(err, ErrInvalidQuery))
+
+	// fn 返回的错误会中断导出
+	stop := errors.New("stop")
+	err = s.WalkGoods("", nil, func(good *Good) error { return stop })
+	assert.Equal(t, stop, err)
+}
+
+func TestParseFormat(t *testing.T) {
+	for _, name := range []string{"csv", "XLSX", "jsonl"} {
+		f, err := ParseFormat(name)
+		if assert.NoError(t, err) {
+			assert.Equal(t, Format(strings.ToLower(name)), f)
+		}
+	}
+	_, err := ParseFormat("pdf")
+	assert.True(t, errors.Is(err, ErrInvalidQuery))
+}
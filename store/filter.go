@@ -0,0 +1,248 @@
+package store
+
+import (
+	"fmt"
+	"math"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// Filter 查询宝贝的条件，零值和 nil 表示不限制
+type Filter struct {
+	// Latest 只返回每个宝贝的最新状态
+	Latest bool
+
+	// Start 和 End 限制入库时间在 (Start, End) 之间
+	Start int64
+	End   int64
+
+	// Brandless 是否没有品牌
+	Brandless *bool
+
+	// ScaleOut 是否缺货
+	ScaleOut *bool
+
+	// MinComments 和 MaxComments 限制评论数在 [MinComments, MaxComments] 之间
+	MinComments *int
+	MaxComments *int
+
+	// Express 品牌等于 Express
+	Express string
+
+	// ExpressLike 品牌包含 ExpressLike，不区分大小写
+	ExpressLike string
+
+	// Category 分类为 Category 或者 Category 的子分类
+	Category string
+
+	// MinPrice 和 MaxPrice 限制价格在 [MinPrice, MaxPrice] 之间
+	MinPrice *float64
+	MaxPrice *float64
+
+	// IDs 宝贝的 ID 在 IDs 中
+	IDs []int64
+
+	// States 审核状态在 States 中
+	States []State
+
+	// Tag 有标签 Tag
+	Tag string
+
+	// Reviewer 最后一次修改审核信息的人为 Reviewer
+	Reviewer string
+
+	// Deleted 只查询回收站中的宝贝，为 false 时只查询没有被删除的宝贝
+	Deleted bool
+
+	// Sort 排序的字段，为空时按照入库时间倒序，全文搜索时为空按照相关度倒序
+	Sort []Sort
+}
+
+// Sort 按照 Field 排序，Field 为 Good 的 JSON 字段名
+type Sort struct {
+	Field string `json:"field"`
+
+	Desc bool `json:"desc"`
+}
+
+// sortColumns 可以排序的字段和对应的列
+var sortColumns = map[string]string{
+	"timestamp":  "timestamp",
+	"firstSeen":  "first_seen",
+	"lastSeen":   "last_seen",
+	"comments":   "comments",
+	"price":      "price",
+	"rating":     "rating",
+	"depth":      "depth",
+	"title":      "title",
+	"express":    "express",
+	"category":   "category",
+	"state":      "state",
+	"reviewedAt": "reviewed_at",
+}
+
+// ParseSort 解析以逗号分隔的 field:asc 或者 field:desc，省略方向时为 asc
+func ParseSort(s string) ([]Sort, error) {
+	sorts := make([]Sort, 0)
+	for _, item := range split(s) {
+		field, direction := item, "asc"
+		if i := strings.LastIndex(item, ":"); i >= 0 {
+			field, direction = item[:i], strings.ToLower(item[i+1:])
+		}
+		if _, ok := sortColumns[field]; !ok {
+			return nil, fmt.Errorf("%w: unknown sort field %q", ErrInvalidQuery, field)
+		}
+		switch direction {
+		case "asc", "desc":
+		default:
+			return nil, fmt.Errorf("%w: unknown sort direction %q", ErrInvalidQuery, direction)
+		}
+		sorts = append(sorts, Sort{Field: field, Desc: direction == "desc"})
+	}
+	return sorts, nil
+}
+
+// restricted 是否有限制宝贝范围的条件，批量修改、删除和恢复时需要有条件，避免误操作所有的宝贝
+func (f *Filter) restricted() bool {
+	return f != nil && (f.Latest || f.Start > 0 || f.End > 0 || f.Brandless != nil || f.ScaleOut != nil ||
+		f.MinComments != nil || f.MaxComments != nil || f.Express != "" || f.ExpressLike != "" || f.Category != "" ||
+		f.MinPrice != nil || f.MaxPrice != nil || len(f.IDs) > 0 || len(f.States) > 0 || f.Tag != "" || f.Reviewer != "")
+}
+
+// ParseFilter 解析查询参数中的查询条件，列表、导出和命令行使用相同的参数:
+//
+//	latest                   只返回每个宝贝的最新状态
+//	start, end               入库时间的范围
+//	brandless, scaleOut      是否没有品牌、是否缺货
+//	minComments, maxComments 评论数的范围
+//	express, expressLike     品牌等于、品牌包含
+//	category                 分类及其子分类
+//	minPrice, maxPrice       价格的范围
+//	ids                      以逗号分隔的宝贝 ID
+//	state                    以逗号分隔的审核状态
+//	tag, reviewer            审核标签、审核人
+//	sort                     以逗号分隔的 field:asc 或者 field:desc
+func ParseFilter(values url.Values) (*Filter, error) {
+	filter := &Filter{
+		Express:     strings.TrimSpace(values.Get("express")),
+		ExpressLike: strings.TrimSpace(values.Get("expressLike")),
+		Category:    strings.TrimSpace(values.Get("category")),
+		Tag:         strings.TrimSpace(values.Get("tag")),
+		Reviewer:    strings.TrimSpace(values.Get("reviewer")),
+	}
+
+	for _, item := range split(values.Get("ids")) {
+		id, err := strconv.ParseInt(item, 10, 64)
+		if err != nil || id <= 0 {
+			return nil, fmt.Errorf("%w: invalid id %q", ErrInvalidQuery, item)
+		}
+		filter.IDs = append(filter.IDs, id)
+	}
+	for _, item := range split(values.Get("state")) {
+		state, err := ParseState(item)
+		if err != nil {
+			return nil, err
+		}
+		filter.States = append(filter.States, state)
+	}
+
+	latest, err := parseBool(values, "latest")
+	if err != nil {
+		return nil, err
+	}
+	filter.Latest = latest != nil && *latest
+
+	for key, dst := range map[string]*int64{"start": &filter.Start, "end": &filter.End} {
+		n, err := parseInt(values, key)
+		if err != nil {
+			return nil, err
+		}
+		if n != nil {
+			*dst = int64(*n)
+		}
+	}
+	if filter.Start > 0 && filter.End > 0 && filter.Start >= filter.End {
+		return nil, fmt.Errorf("%w: start must be less than end", ErrInvalidQuery)
+	}
+
+	for key, dst := range map[string]**bool{"brandless": &filter.Brandless, "scaleOut": &filter.ScaleOut} {
+		if *dst, err = parseBool(values, key); err != nil {
+			return nil, err
+		}
+	}
+
+	for key, dst := range map[string]**int{"minComments": &filter.MinComments, "maxComments": &filter.MaxComments} {
+		if *dst, err = parseInt(values, key); err != nil {
+			return nil, err
+		}
+	}
+	if filter.MinComments != nil && filter.MaxComments != nil && *filter.MinComments > *filter.MaxComments {
+		return nil, fmt.Errorf("%w: minComments must not be greater than maxComments", ErrInvalidQuery)
+	}
+
+	for key, dst := range map[string]**float64{"minPrice": &filter.MinPrice, "maxPrice": &filter.MaxPrice} {
+		if *dst, err = parseFloat(values, key); err != nil {
+			return nil, err
+		}
+	}
+	if filter.MinPrice != nil && filter.MaxPrice != nil && *filter.MinPrice > *filter.MaxPrice {
+		return nil, fmt.Errorf("%w: minPrice must not be greater than maxPrice", ErrInvalidQuery)
+	}
+
+	if filter.Sort, err = ParseSort(values.Get("sort")); err != nil {
+		return nil, err
+	}
+
+	return filter, nil
+}
+
+// split 返回以逗号分隔的非空字符串
+func split(s string) []string {
+	items := make([]string, 0)
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// parseBool 解析布尔类型的参数，参数不存在时返回 nil
+func parseBool(values url.Values, key string) (*bool, error) {
+	value := values.Get(key)
+	if value == "" {
+		return nil, nil
+	}
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s must be a boolean, got %q", ErrInvalidQuery, key, value)
+	}
+	return &b, nil
+}
+
+// parseInt 解析不小于 0 的整数参数，参数不存在时返回 nil
+func parseInt(values url.Values, key string) (*int, error) {
+	value := values.Get(key)
+	if value == "" {
+		return nil, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 0 {
+		return nil, fmt.Errorf("%w: %s must be a non-negative integer, got %q", ErrInvalidQuery, key, value)
+	}
+	return &n, nil
+}
+
+// parseFloat 解析不小于 0 的浮点数参数，参数不存在时返回 nil
+func parseFloat(values url.Values, key string) (*float64, error) {
+	value := values.Get(key)
+	if value == "" {
+		return nil, nil
+	}
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil || f < 0 || math.IsNaN(f) || math.IsInf(f, 0) {
+		return nil, fmt.Errorf("%w: %s must be a non-negative number, got %q", ErrInvalidQuery, key, value)
+	}
+	return &f, nil
+}
@@ -0,0 +1,75 @@
+package store
+
+import (
+	"errors"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseFilter(t *testing.T) {
+	values, _ := url.ParseQuery("latest=true&start=100&brandless=false&minComments=3&expressLike=%20app%20&category=Son&maxPrice=9.5&sort=price:desc")
+	f, err := ParseFilter(values)
+	if assert.NoError(t, err) {
+		assert.True(t, f.Latest)
+		assert.Equal(t, int64(100), f.Start)
+		assert.Zero(t, f.End)
+		if assert.NotNil(t, f.Brandless) {
+			assert.False(t, *f.Brandless)
+		}
+		assert.Nil(t, f.ScaleOut)
+		if assert.NotNil(t, f.MinComments) {
+			assert.Equal(t, 3, *f.MinComments)
+		}
+		assert.Nil(t, f.MaxComments)
+		assert.Equal(t, "app", f.ExpressLike)
+		assert.Equal(t, "Son", f.Category)
+		assert.Nil(t, f.MinPrice)
+		if assert.NotNil(t, f.MaxPrice) {
+			assert.Equal(t, 9.5, *f.MaxPrice)
+		}
+		assert.Equal(t, []Sort{{Field: "price", Desc: true}}, f.Sort)
+	}
+
+	values, _ = url.ParseQuery("ids=1,%202&state=Listed,new&tag=promo")
+	f, err = ParseFilter(values)
+	if assert.NoError(t, err) {
+		assert.Equal(t, []int64{1, 2}, f.IDs)
+		assert.Equal(t, []State{StateListed, StateNew}, f.States)
+		assert.Equal(t, "promo", f.Tag)
+	}
+
+	for _, query := range []string{
+		"latest=yes",
+		"start=-1",
+		"start=200&end=100",
+		"minComments=5&maxComments=1",
+		"minPrice=NaN",
+		"minPrice=10&maxPrice=1",
+		"sort=uid",
+		"ids=1,x",
+		"state=new,deleted",
+	} {
+		values, _ := url.ParseQuery(query)
+		_, err = ParseFilter(values)
+		assert.True(t, errors.Is(err, ErrInvalidQuery), query)
+	}
+}
+
+func TestParseSort(t *testing.T) {
+	sorts, err := ParseSort("price, comments:DESC ,")
+	if assert.NoError(t, err) {
+		assert.Equal(t, []Sort{{Field: "price"}, {Field: "comments", Desc: true}}, sorts)
+	}
+
+	sorts, err = ParseSort("")
+	if assert.NoError(t, err) {
+		assert.Len(t, sorts, 0)
+	}
+
+	_, err = ParseSort("uid:asc")
+	assert.True(t, errors.Is(err, ErrInvalidQuery))
+	_, err = ParseSort("price:up")
+	assert.True(t, errors.Is(err, ErrInvalidQuery))
+}
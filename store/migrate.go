@@ -0,0 +1,266 @@
+package store
+
+import (
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/lack-io/cirrus/config"
+)
+
+// Migration 一个版本的表结构变更，up 升级到 Version，down 回滚到上一个版本。
+// up 需要兼容使用 AutoMigrate 创建的旧数据库，表、字段和索引已经存在时跳过
+type Migration struct {
+	Version int
+
+	Name string
+
+	up   func(tx *gorm.DB) error
+	down func(tx *gorm.DB) error
+}
+
+// MigrationStatus 迁移的执行状态
+type MigrationStatus struct {
+	Version int `json:"version"`
+
+	Name string `json:"name"`
+
+	// Applied 是否已经执行
+	Applied bool `json:"applied"`
+
+	// AppliedAt 执行的时间
+	AppliedAt int64 `json:"appliedAt"`
+
+	// Unknown 数据库中执行过但是程序中不存在的迁移，通常由新版本的程序执行
+	Unknown bool `json:"unknown"`
+}
+
+// schemaMigration schema_migrations 表中执行过的迁移
+type schemaMigration struct {
+	Version int `gorm:"column:version"`
+
+	Name string `gorm:"column:name"`
+
+	AppliedAt int64 `gorm:"column:applied_at"`
+}
+
+// Migrator 按照 migrations 的版本升级或者回滚数据库的表结构，执行过的版本记录在 schema_migrations 表中
+type Migrator struct {
+	db *gorm.DB
+}
+
+// NewMigrator 根据 cfg.DB 连接数据库，不会修改表结构
+func NewMigrator(cfg *config.Store) (*Migrator, error) {
+	dialector, err := dialector(cfg)
+	if err != nil {
+		return nil, err
+	}
+	db, err := connect(dialector)
+	if err != nil {
+		return nil, err
+	}
+	return &Migrator{db: db}, nil
+}
+
+// Latest 返回程序支持的最新版本
+func (m *Migrator) Latest() int {
+	return migrations[len(migrations)-1].Version
+}
+
+// Version 返回数据库当前的版本，没有执行过迁移时返回 0
+func (m *Migrator) Version() (int, error) {
+	if err := m.prepare(); err != nil {
+		return 0, err
+	}
+	return m.version(m.db)
+}
+
+func (m *Migrator) version(db *gorm.DB) (int, error) {
+	var version int
+	err := db.Raw("SELECT COALESCE(MAX(version), 0) FROM schema_migrations").Row().Scan(&version)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %v", ErrDBRead, err)
+	}
+	return version, nil
+}
+
+// Status 返回所有迁移的执行状态，包括数据库中执行过但是程序中不存在的迁移
+func (m *Migrator) Status() ([]*MigrationStatus, error) {
+	if err := m.prepare(); err != nil {
+		return nil, err
+	}
+
+	applied := make([]*schemaMigration, 0)
+	err := m.db.Table("schema_migrations").Order("version").Find(&applied).Error
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrDBRead, err)
+	}
+	appliedAt := map[int]int64{}
+	for _, a := range applied {
+		appliedAt[a.Version] = a.AppliedAt
+	}
+
+	status := make([]*MigrationStatus, 0, len(migrations))
+	for _, migration := range migrations {
+		at, ok := appliedAt[migration.Version]
+		status = append(status, &MigrationStatus{
+			Version:   migration.Version,
+			Name:      migration.Name,
+			Applied:   ok,
+			AppliedAt: at,
+		})
+	}
+	for _, a := range applied {
+		if a.Version > m.Latest() {
+			status = append(status, &MigrationStatus{
+				Version:   a.Version,
+				Name:      a.Name,
+				Applied:   true,
+				AppliedAt: a.AppliedAt,
+				Unknown:   true,
+			})
+		}
+	}
+	return status, nil
+}
+
+// Up 依次执行版本不超过 to 的迁移，to 为 0 时升级到最新的版本。
+// 数据库的版本比程序支持的最新版本新时返回 ErrSchemaAhead
+func (m *Migrator) Up(to int) error {
+	if to == 0 {
+		to = m.Latest()
+	}
+	if to > m.Latest() {
+		return fmt.Errorf("%w: unknown version %d", ErrInvalidQuery, to)
+	}
+	if err := m.prepare(); err != nil {
+		return err
+	}
+	current, err := m.version(m.db)
+	if err != nil {
+		return err
+	}
+	if current > m.Latest() {
+		return fmt.Errorf("%w: version %d, cirrus supports up to %d", ErrSchemaAhead, current, m.Latest())
+	}
+
+	for _, migration := range migrations {
+		if migration.Version <= current || migration.Version > to {
+			continue
+		}
+		err = m.db.Transaction(func(tx *gorm.DB) error {
+			if err := migration.up(tx); err != nil {
+				return err
+			}
+			return tx.Table("schema_migrations").Create(&schemaMigration{
+				Version:   migration.Version,
+				Name:      migration.Name,
+				AppliedAt: time.Now().Unix(),
+			}).Error
+		})
+		if err != nil {
+			return fmt.Errorf("%w: migrate up to %d %s: %v", ErrDBWrite, migration.Version, migration.Name, err)
+		}
+	}
+	return nil
+}
+
+// Down 从当前版本开始依次回滚版本大于 to 的迁移，to 为 0 时回滚所有的迁移。
+// 数据库的版本比程序支持的最新版本新时返回 ErrSchemaAhead
+func (m *Migrator) Down(to int) error {
+	if to < 0 {
+		return fmt.Errorf("%w: unknown version %d", ErrInvalidQuery, to)
+	}
+	if err := m.prepare(); err != nil {
+		return err
+	}
+	current, err := m.version(m.db)
+	if err != nil {
+		return err
+	}
+	if current > m.Latest() {
+		return fmt.Errorf("%w: version %d, cirrus supports up to %d", ErrSchemaAhead, current, m.Latest())
+	}
+
+	for i := len(migrations) - 1; i >= 0; i-- {
+		migration := migrations[i]
+		if migration.Version > current || migration.Version <= to {
+			continue
+		}
+		err = m.db.Transaction(func(tx *gorm.DB) error {
+			if err := migration.down(tx); err != nil {
+				return err
+			}
+			return tx.Exec("DELETE FROM schema_migrations WHERE version = ?", migration.Version).Error
+		})
+		if err != nil {
+			return fmt.Errorf("%w: migrate down from %d %s: %v", ErrDBWrite, migration.Version, migration.Name, err)
+		}
+	}
+	return nil
+}
+
+// prepare 创建 schema_migrations 表
+func (m *Migrator) prepare() error {
+	err := m.db.Exec(`CREATE TABLE IF NOT EXISTS schema_migrations (
+	version bigint PRIMARY KEY,
+	name text NOT NULL,
+	applied_at bigint NOT NULL
+)`).Error
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrDBWrite, err)
+	}
+	return nil
+}
+
+// Close 断开与数据库的连接
+func (m *Migrator) Close() error {
+	sqlDB, err := m.db.DB()
+	if err != nil {
+		return err
+	}
+	return sqlDB.Close()
+}
+
+// primaryKey 自增主键的类型
+func primaryKey(tx *gorm.DB) string {
+	if tx.Dialector.Name() == "postgres" {
+		return "bigserial PRIMARY KEY"
+	}
+	return "integer PRIMARY KEY AUTOINCREMENT"
+}
+
+// addColumn 字段不存在时为 table 添加字段，definition 为字段的类型和默认值
+func addColumn(tx *gorm.DB, table, column, definition string) error {
+	columns, err := tx.Migrator().ColumnTypes(table)
+	if err != nil {
+		return err
+	}
+	for _, c := range columns {
+		if c.Name() == column {
+			return nil
+		}
+	}
+	return tx.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, definition)).Error
+}
+
+// dropColumns 删除 table 的字段，字段上的索引需要先删除
+func dropColumns(tx *gorm.DB, table string, columns ...string) error {
+	for _, column := range columns {
+		if err := tx.Exec(fmt.Sprintf("ALTER TABLE %s DROP COLUMN %s", table, column)).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// exec 依次执行 statements
+func exec(tx *gorm.DB, statements ...string) error {
+	for _, statement := range statements {
+		if err := tx.Exec(statement).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
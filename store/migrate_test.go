@@ -0,0 +1,164 @@
+package store
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"github.com/lack-io/cirrus/config"
+)
+
+func TestMigrator(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "cirrus.db")
+	cfg := &config.Store{DB: config.Sqlite, Sqlite: &config.DBSqlite{Name: name}}
+
+	m, err := NewMigrator(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+
+	version, err := m.Version()
+	if assert.NoError(t, err) {
+		assert.Equal(t, 0, version)
+	}
+	status, err := m.Status()
+	if assert.NoError(t, err) && assert.Len(t, status, len(migrations)) {
+		assert.Equal(t, "create_goods", status[0].Name)
+		assert.False(t, status[0].Applied)
+	}
+
+	assert.NoError(t, m.Up(3))
+	version, _ = m.Version()
+	assert.Equal(t, 3, version)
+	assert.True(t, hasColumn(t, m.db, "goods", "latest"))
+	assert.False(t, m.db.Migrator().HasTable("observations"))
+
+	assert.NoError(t, m.Up(0))
+	version, _ = m.Version()
+	assert.Equal(t, m.Latest(), version)
+	status, err = m.Status()
+	if assert.NoError(t, err) {
+		for _, s := range status {
+			assert.True(t, s.Applied, s.Name)
+			assert.NotZero(t, s.AppliedAt, s.Name)
+		}
+	}
+	assert.True(t, errors.Is(m.Up(m.Latest()+1), ErrInvalidQuery))
+
+	s, err := NewSqlite(cfg.Sqlite)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.NoError(t, s.AddGood(&Good{UID: "a", Title: "clavier", Brandless: true, Timestamp: 100}))
+	good, err := s.GetGoodByUID("a")
+	if assert.NoError(t, err) {
+		assert.True(t, good.Brandless)
+		assert.Equal(t, StateNew, good.State)
+	}
+
+	// 回滚后全文索引和触发器一起删除
+	assert.NoError(t, m.Down(5))
+	version, _ = m.Version()
+	assert.Equal(t, 5, version)
+	assert.False(t, m.db.Migrator().HasTable("goods_fts"))
+	assert.False(t, m.db.Migrator().HasTable("tombstones"))
+	assert.False(t, hasColumn(t, m.db, "goods", "state"))
+	assert.True(t, hasColumn(t, m.db, "goods", "title"))
+
+	assert.NoError(t, m.Down(0))
+	version, _ = m.Version()
+	assert.Equal(t, 0, version)
+	assert.False(t, m.db.Migrator().HasTable("goods"))
+	assert.False(t, m.db.Migrator().HasTable("observations"))
+
+	assert.NoError(t, m.Up(0))
+	version, _ = m.Version()
+	assert.Equal(t, m.Latest(), version)
+}
+
+func TestMigrator_Ahead(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "cirrus.db")
+	cfg := &config.Store{DB: config.Sqlite, Sqlite: &config.DBSqlite{Name: name}}
+
+	m, err := NewMigrator(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+	assert.NoError(t, m.Up(0))
+
+	// 新版本的程序执行过的迁移
+	err = m.db.Exec("INSERT INTO schema_migrations (version, name, applied_at) VALUES (?, ?, ?)",
+		m.Latest()+1, "from_the_future", 100).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = NewStore(cfg)
+	assert.True(t, errors.Is(err, ErrSchemaAhead))
+	assert.True(t, errors.Is(m.Up(0), ErrSchemaAhead))
+	assert.True(t, errors.Is(m.Down(0), ErrSchemaAhead))
+
+	status, err := m.Status()
+	if assert.NoError(t, err) && assert.Len(t, status, len(migrations)+1) {
+		last := status[len(status)-1]
+		assert.Equal(t, "from_the_future", last.Name)
+		assert.True(t, last.Unknown)
+	}
+}
+
+func TestMigrator_AutoMigrate(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "cirrus.db")
+
+	// 使用 AutoMigrate 创建的数据库没有 schema_migrations 表
+	db, err := gorm.Open(sqlite.Open(name), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.NoError(t, db.Table("goods").AutoMigrate(&Good{}))
+	assert.NoError(t, db.Table("observations").AutoMigrate(&Observation{}))
+	assert.NoError(t, db.Table("tombstones").AutoMigrate(&Tombstone{}))
+	err = db.Exec("INSERT INTO goods (uid, title, timestamp, first_seen, last_seen, latest) VALUES (?, ?, ?, ?, ?, ?)",
+		"a", "clavier", 100, 100, 100, true).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, _ := db.DB()
+	_ = sqlDB.Close()
+
+	s, err := NewSqlite(&config.DBSqlite{Name: name})
+	if err != nil {
+		t.Fatal(err)
+	}
+	version, err := (&Migrator{db: s.db}).Version()
+	if assert.NoError(t, err) {
+		assert.Equal(t, migrations[len(migrations)-1].Version, version)
+	}
+	good, err := s.GetGoodByUID("a")
+	if assert.NoError(t, err) {
+		assert.Equal(t, "clavier", good.Title)
+		assert.Equal(t, StateNew, good.State)
+	}
+	hits, err := s.SearchGoods("clavier", nil, nil)
+	if assert.NoError(t, err) {
+		assert.Len(t, hits, 1)
+	}
+}
+
+func hasColumn(t *testing.T, db *gorm.DB, table, column string) bool {
+	columns, err := db.Migrator().ColumnTypes(table)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range columns {
+		if c.Name() == column {
+			return true
+		}
+	}
+	return false
+}
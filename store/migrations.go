@@ -0,0 +1,192 @@
+package store
+
+import (
+	"gorm.io/gorm"
+)
+
+// migrations 按照版本排序的表结构变更，已经发布的迁移不能修改，修改表结构时在最后添加新的迁移
+var migrations = []*Migration{
+	{
+		Version: 1,
+		Name:    "create_goods",
+		up: func(tx *gorm.DB) error {
+			return tx.Exec(`CREATE TABLE IF NOT EXISTS goods (
+	id ` + primaryKey(tx) + `,
+	uid text,
+	url text,
+	scaleout boolean,
+	brandless boolean,
+	comments bigint,
+	express text,
+	timestamp bigint
+)`).Error
+		},
+		down: func(tx *gorm.DB) error {
+			return tx.Exec("DROP TABLE IF EXISTS goods").Error
+		},
+	},
+	{
+		Version: 2,
+		Name:    "add_goods_provenance",
+		up: func(tx *gorm.DB) error {
+			for _, column := range [][2]string{
+				{"depth", "bigint"}, {"parent", "text"}, {"provenance", "text"},
+			} {
+				if err := addColumn(tx, "goods", column[0], column[1]); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+		down: func(tx *gorm.DB) error {
+			return dropColumns(tx, "goods", "provenance", "parent", "depth")
+		},
+	},
+	{
+		Version: 3,
+		Name:    "add_goods_seen",
+		up: func(tx *gorm.DB) error {
+			for _, column := range [][2]string{
+				{"first_seen", "bigint"}, {"last_seen", "bigint"}, {"latest", "boolean DEFAULT false"},
+			} {
+				if err := addColumn(tx, "goods", column[0], column[1]); err != nil {
+					return err
+				}
+			}
+			// 为之前保存的宝贝补充 first_seen 和 last_seen，并将每个 UID 最后保存的记录标记为最新状态，
+			// 其他重复的记录作为历史状态保留
+			return exec(tx,
+				`UPDATE goods
+SET first_seen = (SELECT MIN(g.timestamp) FROM goods g WHERE g.uid = goods.uid), last_seen = timestamp
+WHERE last_seen IS NULL OR last_seen = 0`,
+				`UPDATE goods SET latest = true
+WHERE id IN (SELECT MAX(g.id) FROM goods g GROUP BY g.uid)
+AND uid NOT IN (SELECT g.uid FROM goods g WHERE g.latest = true)`,
+				`CREATE UNIQUE INDEX IF NOT EXISTS idx_goods_uid ON goods (uid) WHERE latest = true`,
+			)
+		},
+		down: func(tx *gorm.DB) error {
+			if err := tx.Exec("DROP INDEX IF EXISTS idx_goods_uid").Error; err != nil {
+				return err
+			}
+			return dropColumns(tx, "goods", "latest", "last_seen", "first_seen")
+		},
+	},
+	{
+		Version: 4,
+		Name:    "create_observations",
+		up: func(tx *gorm.DB) error {
+			return exec(tx,
+				`CREATE TABLE IF NOT EXISTS observations (
+	id `+primaryKey(tx)+`,
+	uid text,
+	comments bigint,
+	scaleout boolean,
+	shipping text,
+	price double precision,
+	timestamp bigint
+)`,
+				`CREATE INDEX IF NOT EXISTS idx_observations_uid_timestamp ON observations (uid, timestamp)`,
+			)
+		},
+		down: func(tx *gorm.DB) error {
+			return tx.Exec("DROP TABLE IF EXISTS observations").Error
+		},
+	},
+	{
+		Version: 5,
+		Name:    "add_goods_product",
+		up: func(tx *gorm.DB) error {
+			for _, column := range [][2]string{
+				{"title", "text"}, {"price", "double precision"}, {"currency", "text"}, {"seller", "text"},
+				{"category", "text"}, {"rating", "double precision"}, {"image", "text"}, {"ean", "text"},
+			} {
+				if err := addColumn(tx, "goods", column[0], column[1]); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+		down: func(tx *gorm.DB) error {
+			return dropColumns(tx, "goods", "ean", "image", "rating", "category", "seller", "currency", "price", "title")
+		},
+	},
+	{
+		Version: 6,
+		Name:    "create_goods_search",
+		up: func(tx *gorm.DB) error {
+			return searcherFor(tx).init(tx)
+		},
+		down: func(tx *gorm.DB) error {
+			return searcherFor(tx).drop(tx)
+		},
+	},
+	{
+		Version: 7,
+		Name:    "add_goods_filter_indexes",
+		up: func(tx *gorm.DB) error {
+			return exec(tx,
+				`CREATE INDEX IF NOT EXISTS idx_goods_comments ON goods (comments)`,
+				`CREATE INDEX IF NOT EXISTS idx_goods_express ON goods (express)`,
+				`CREATE INDEX IF NOT EXISTS idx_goods_timestamp ON goods (timestamp)`,
+				`CREATE INDEX IF NOT EXISTS idx_goods_price ON goods (price)`,
+				`CREATE INDEX IF NOT EXISTS idx_goods_category ON goods (category)`,
+			)
+		},
+		down: func(tx *gorm.DB) error {
+			return exec(tx,
+				`DROP INDEX IF EXISTS idx_goods_category`,
+				`DROP INDEX IF EXISTS idx_goods_price`,
+				`DROP INDEX IF EXISTS idx_goods_timestamp`,
+				`DROP INDEX IF EXISTS idx_goods_express`,
+				`DROP INDEX IF EXISTS idx_goods_comments`,
+			)
+		},
+	},
+	{
+		Version: 8,
+		Name:    "add_goods_curation",
+		up: func(tx *gorm.DB) error {
+			for _, column := range [][2]string{
+				{"state", "text DEFAULT 'new'"}, {"notes", "text"}, {"tags", "text"},
+				{"reviewer", "text"}, {"reviewed_at", "bigint"},
+			} {
+				if err := addColumn(tx, "goods", column[0], column[1]); err != nil {
+					return err
+				}
+			}
+			return exec(tx,
+				`UPDATE goods SET state = 'new' WHERE state IS NULL`,
+				`CREATE INDEX IF NOT EXISTS idx_goods_state ON goods (state)`,
+			)
+		},
+		down: func(tx *gorm.DB) error {
+			if err := tx.Exec("DROP INDEX IF EXISTS idx_goods_state").Error; err != nil {
+				return err
+			}
+			return dropColumns(tx, "goods", "reviewed_at", "reviewer", "tags", "notes", "state")
+		},
+	},
+	{
+		Version: 9,
+		Name:    "add_goods_trash",
+		up: func(tx *gorm.DB) error {
+			if err := addColumn(tx, "goods", "deleted_at", "bigint NOT NULL DEFAULT 0"); err != nil {
+				return err
+			}
+			return exec(tx,
+				`CREATE INDEX IF NOT EXISTS idx_goods_deleted_at ON goods (deleted_at)`,
+				`CREATE TABLE IF NOT EXISTS tombstones (
+	uid text PRIMARY KEY,
+	deleted_at bigint
+)`,
+			)
+		},
+		down: func(tx *gorm.DB) error {
+			if err := exec(tx, "DROP TABLE IF EXISTS tombstones", "DROP INDEX IF EXISTS idx_goods_deleted_at"); err != nil {
+				return err
+			}
+			return dropColumns(tx, "goods", "deleted_at")
+		},
+	},
+}
@@ -0,0 +1,72 @@
+package store
+
+import (
+	"fmt"
+	"strings"
+
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+
+	"github.com/lack-io/cirrus/config"
+)
+
+// NewPostgres 使用 PostgreSQL 保存宝贝，多个实例可以共享同一个数据库
+func NewPostgres(cfg *config.DBPostgres) (*DB, error) {
+	dialector, err := postgresDialector(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return open(dialector)
+}
+
+func postgresDialector(cfg *config.DBPostgres) (gorm.Dialector, error) {
+	if cfg == nil || cfg.DSN == "" {
+		return nil, fmt.Errorf("%w: missing cfg postgres", ErrInvalidConfig)
+	}
+	return postgres.Open(cfg.DSN), nil
+}
+
+// postgresIndex 创建全文索引的语句，search 为按照名称、分类、品牌和网址的顺序设置权重的 tsvector，
+// 网址中的分隔符替换为空格以便搜索网址中的单词
+var postgresIndex = []string{
+	`ALTER TABLE goods ADD COLUMN IF NOT EXISTS search tsvector GENERATED ALWAYS AS (
+	setweight(to_tsvector('simple', coalesce(title, '')), 'A') ||
+	setweight(to_tsvector('simple', coalesce(category, '')), 'B') ||
+	setweight(to_tsvector('simple', coalesce(express, '')), 'C') ||
+	setweight(to_tsvector('simple', translate(coalesce(url, ''), '/.-_:?=&', '        ')), 'D')
+) STORED`,
+	`CREATE INDEX IF NOT EXISTS idx_goods_search ON goods USING GIN (search)`,
+}
+
+// postgresHeadline ts_headline 的选项，返回高亮后的完整字段
+const postgresHeadline = `'StartSel=' || chr(2) || ', StopSel=' || chr(3) || ', HighlightAll=true'`
+
+// postgresSearcher 使用 goods 表的 search 字段和 GIN 索引全文搜索，按照 ts_rank 排序，需要 PostgreSQL 12 以上
+type postgresSearcher struct{}
+
+func (s *postgresSearcher) init(db *gorm.DB) error {
+	for _, statement := range postgresIndex {
+		if err := db.Exec(statement).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *postgresSearcher) drop(db *gorm.DB) error {
+	return exec(db, "DROP INDEX IF EXISTS idx_goods_search", "ALTER TABLE goods DROP COLUMN IF EXISTS search")
+}
+
+func (s *postgresSearcher) match(db *gorm.DB, q string) *gorm.DB {
+	return db.Joins("CROSS JOIN plainto_tsquery('simple', ?) AS query", strings.Join(terms(q), " ")).
+		Where("goods.search @@ query")
+}
+
+func (s *postgresSearcher) columns() string {
+	columns := []string{"goods.*", "ts_rank(goods.search, query) AS score"}
+	for _, field := range []string{"title", "express", "category", "url"} {
+		columns = append(columns, fmt.Sprintf("ts_headline('simple', coalesce(goods.%s, ''), query, %s) AS %s_hl",
+			field, postgresHeadline, field))
+	}
+	return strings.Join(columns, ", ")
+}
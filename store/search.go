@@ -0,0 +1,115 @@
+package store
+
+import (
+	"fmt"
+	"html"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// 数据库高亮命中的词时使用的标记，返回前替换为 <mark> 和 </mark>，
+// 这样可以先对字段的原文做 HTML 转义
+const (
+	markStart = "\x02"
+	markEnd   = "\x03"
+)
+
+// marks 将高亮标记替换为 HTML 标签
+var marks = strings.NewReplacer(markStart, "<mark>", markEnd, "</mark>")
+
+// Hit 全文搜索命中的宝贝
+type Hit struct {
+	*Good
+
+	// Score 相关度，越大越相关
+	Score float64 `json:"score"`
+
+	// Highlight 命中的字段，key 为 title、express、category 或 url，命中的词使用 <mark></mark> 包裹
+	Highlight map[string]string `json:"highlight"`
+}
+
+// searcher 不同数据库的全文搜索实现，搜索 goods 表的 title、express、category 和 url 字段
+type searcher interface {
+	// init 创建全文索引，以及让索引与 goods 表保持同步的触发器
+	init(db *gorm.DB) error
+	// drop 删除全文索引和触发器
+	drop(db *gorm.DB) error
+	// match 添加匹配 q 的查询条件
+	match(db *gorm.DB, q string) *gorm.DB
+	// columns 返回查询的字段，包括 goods 表的所有字段、相关度 score 和高亮的 <field>_hl
+	columns() string
+}
+
+// searcherFor 返回 db 对应的全文搜索实现
+func searcherFor(db *gorm.DB) searcher {
+	if db.Dialector.Name() == "postgres" {
+		return &postgresSearcher{}
+	}
+	return &sqliteSearcher{}
+}
+
+// hit 搜索结果的一行
+type hit struct {
+	Good
+
+	Score      float64 `gorm:"column:score"`
+	TitleHL    string  `gorm:"column:title_hl"`
+	ExpressHL  string  `gorm:"column:express_hl"`
+	CategoryHL string  `gorm:"column:category_hl"`
+	URLHL      string  `gorm:"column:url_hl"`
+}
+
+func (h *hit) hit() *Hit {
+	good := h.Good
+	out := &Hit{Good: &good, Score: h.Score, Highlight: map[string]string{}}
+	for field, text := range map[string]string{
+		"title":    h.TitleHL,
+		"express":  h.ExpressHL,
+		"category": h.CategoryHL,
+		"url":      h.URLHL,
+	} {
+		if strings.Contains(text, markStart) {
+			out.Highlight[field] = marks.Replace(html.EscapeString(text))
+		}
+	}
+	return out
+}
+
+// terms 将用户输入的 q 按照空白拆分为多个词，返回的词都不为空
+func terms(q string) []string {
+	return strings.Fields(q)
+}
+
+// search 返回全文搜索 q 并且满足 f 的查询，读取前需要 Select(s.searcher.columns())
+func (s *DB) search(q string, f *Filter) (*gorm.DB, error) {
+	if len(terms(q)) == 0 {
+		return nil, fmt.Errorf("%w: empty search", ErrInvalidQuery)
+	}
+	return order(where(s.searcher.match(s.db.Table("goods"), q), f), f, "score desc", "goods.timestamp desc")
+}
+
+func (s *DB) SearchGoods(q string, f *Filter, pg *Pagination) ([]*Hit, error) {
+	db, err := s.search(q, f)
+	if err != nil {
+		return nil, err
+	}
+	if pg != nil {
+		if err := db.Count(&pg.Total).Error; err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrDBRead, err)
+		}
+		db = db.Limit(pg.Size).Offset((pg.Page - 1) * pg.Size)
+	}
+
+	rows := make([]*hit, 0)
+	err = db.Select(s.searcher.columns()).Find(&rows).Error
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrDBRead, err)
+	}
+
+	hits := make([]*Hit, 0, len(rows))
+	for _, row := range rows {
+		hits = append(hits, row.hit())
+	}
+	return hits, nil
+}
@@ -0,0 +1,166 @@
+package store
+
+import (
+	"fmt"
+	"strings"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"github.com/lack-io/cirrus/config"
+)
+
+// NewSqlite 使用本地 sqlite 文件保存宝贝，适用于单机爬取
+func NewSqlite(cfg *config.DBSqlite) (*DB, error) {
+	dialector, err := sqliteDialector(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return open(dialector)
+}
+
+func sqliteDialector(cfg *config.DBSqlite) (gorm.Dialector, error) {
+	if cfg == nil || cfg.Name == "" {
+		return nil, fmt.Errorf("%w: missing cfg sqlite", ErrInvalidConfig)
+	}
+	return sqlite.Open(cfg.Name), nil
+}
+
+// sqliteTriggers 保持 goods_fts 与 goods 表同步的触发器
+var sqliteTriggers = []string{"goods_fts_ai", "goods_fts_ad", "goods_fts_au", "goods_fts_bu", "goods_fts_bd"}
+
+// sqliteFTS5 使用 FTS5 时创建全文索引的语句
+var sqliteFTS5 = []string{
+	`CREATE VIRTUAL TABLE IF NOT EXISTS goods_fts USING fts5(title, express, category, url, content='goods', content_rowid='id')`,
+	`CREATE TRIGGER goods_fts_ai AFTER INSERT ON goods BEGIN
+	INSERT INTO goods_fts(rowid, title, express, category, url) VALUES (new.id, new.title, new.express, new.category, new.url);
+END`,
+	`CREATE TRIGGER goods_fts_ad AFTER DELETE ON goods BEGIN
+	INSERT INTO goods_fts(goods_fts, rowid, title, express, category, url) VALUES ('delete', old.id, old.title, old.express, old.category, old.url);
+END`,
+	`CREATE TRIGGER goods_fts_au AFTER UPDATE ON goods BEGIN
+	INSERT INTO goods_fts(goods_fts, rowid, title, express, category, url) VALUES ('delete', old.id, old.title, old.express, old.category, old.url);
+	INSERT INTO goods_fts(rowid, title, express, category, url) VALUES (new.id, new.title, new.express, new.category, new.url);
+END`,
+	`INSERT INTO goods_fts(goods_fts) VALUES ('rebuild')`,
+}
+
+// sqliteFTS4 没有 FTS5 时创建全文索引的语句
+var sqliteFTS4 = []string{
+	`CREATE VIRTUAL TABLE IF NOT EXISTS goods_fts USING fts4(content="goods", title, express, category, url)`,
+	`CREATE TRIGGER goods_fts_bu BEFORE UPDATE ON goods BEGIN
+	DELETE FROM goods_fts WHERE docid = old.id;
+END`,
+	`CREATE TRIGGER goods_fts_bd BEFORE DELETE ON goods BEGIN
+	DELETE FROM goods_fts WHERE docid = old.id;
+END`,
+	`CREATE TRIGGER goods_fts_au AFTER UPDATE ON goods BEGIN
+	INSERT INTO goods_fts(docid, title, express, category, url) VALUES (new.id, new.title, new.express, new.category, new.url);
+END`,
+	`CREATE TRIGGER goods_fts_ai AFTER INSERT ON goods BEGIN
+	INSERT INTO goods_fts(docid, title, express, category, url) VALUES (new.id, new.title, new.express, new.category, new.url);
+END`,
+	`INSERT INTO goods_fts(goods_fts) VALUES ('rebuild')`,
+}
+
+// sqliteSearcher 使用 goods_fts 虚拟表全文搜索。使用 sqlite_fts5 标签编译时使用 FTS5，按照 bm25 排序，
+// 名称的权重最高；否则使用 FTS4，按照命中的次数排序
+type sqliteSearcher struct {
+	fts5 bool
+}
+
+// FTS4 判断全文搜索是否降级为 FTS4，没有使用 sqlite_fts5 标签编译时 sqlite 不支持 FTS5，
+// 搜索结果按照命中的次数排序，并且没有字段权重
+func (s *DB) FTS4() bool {
+	searcher, ok := s.searcher.(*sqliteSearcher)
+	return ok && !searcher.fts5
+}
+
+func (s *sqliteSearcher) init(db *gorm.DB) error {
+	var enabled bool
+	err := db.Raw("SELECT sqlite_compileoption_used('ENABLE_FTS5')").Row().Scan(&enabled)
+	if err != nil {
+		return err
+	}
+	s.fts5 = enabled
+
+	module, statements := "fts4", sqliteFTS4
+	if s.fts5 {
+		module, statements = "fts5", sqliteFTS5
+	}
+
+	var tables []string
+	err = db.Table("sqlite_master").Where("type = ? AND name = ?", "table", "goods_fts").Pluck("sql", &tables).Error
+	if err != nil {
+		return err
+	}
+	var triggers int64
+	err = db.Table("sqlite_master").Where("type = ? AND name IN ?", "trigger", sqliteTriggers).Count(&triggers).Error
+	if err != nil {
+		return err
+	}
+	// 全文索引已经存在并且触发器完整时不需要重建，goods 表被重建时触发器会被删除
+	if len(tables) > 0 && strings.Contains(strings.ToLower(tables[0]), module) && int(triggers) == len(statements)-2 {
+		return nil
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		for _, trigger := range sqliteTriggers {
+			if err := tx.Exec("DROP TRIGGER IF EXISTS " + trigger).Error; err != nil {
+				return err
+			}
+		}
+		// 切换 FTS4 和 FTS5 时需要重新创建全文索引
+		if len(tables) > 0 && !strings.Contains(strings.ToLower(tables[0]), module) {
+			if err := tx.Exec("DROP TABLE goods_fts").Error; err != nil {
+				return err
+			}
+		}
+		for _, statement := range statements {
+			if err := tx.Exec(statement).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (s *sqliteSearcher) drop(db *gorm.DB) error {
+	for _, trigger := range sqliteTriggers {
+		if err := db.Exec("DROP TRIGGER IF EXISTS " + trigger).Error; err != nil {
+			return err
+		}
+	}
+	return db.Exec("DROP TABLE IF EXISTS goods_fts").Error
+}
+
+func (s *sqliteSearcher) match(db *gorm.DB, q string) *gorm.DB {
+	// 每个词作为一个短语，避免用户输入的 AND、OR、NOT、* 和引号等被当作查询语法
+	phrases := make([]string, 0)
+	for _, term := range terms(q) {
+		phrases = append(phrases, `"`+strings.ReplaceAll(term, `"`, `""`)+`"`)
+	}
+
+	rowid := "docid"
+	if s.fts5 {
+		rowid = "rowid"
+	}
+	return db.Joins("JOIN goods_fts ON goods_fts."+rowid+" = goods.id").
+		Where("goods_fts MATCH ?", strings.Join(phrases, " "))
+}
+
+func (s *sqliteSearcher) columns() string {
+	if s.fts5 {
+		return `goods.*, -bm25(goods_fts, 10.0, 2.0, 5.0, 1.0) AS score,
+highlight(goods_fts, 0, char(2), char(3)) AS title_hl,
+highlight(goods_fts, 1, char(2), char(3)) AS express_hl,
+highlight(goods_fts, 2, char(2), char(3)) AS category_hl,
+highlight(goods_fts, 3, char(2), char(3)) AS url_hl`
+	}
+	// offsets 对每次命中返回 4 个以空格分隔的整数
+	return `goods.*, (length(offsets(goods_fts)) - length(replace(offsets(goods_fts), ' ', '')) + 1) / 4.0 AS score,
+snippet(goods_fts, char(2), char(3), '...', 0, 64) AS title_hl,
+snippet(goods_fts, char(2), char(3), '...', 1, 64) AS express_hl,
+snippet(goods_fts, char(2), char(3), '...', 2, 64) AS category_hl,
+snippet(goods_fts, char(2), char(3), '...', 3, 64) AS url_hl`
+}
@@ -1,11 +1,11 @@
 package store
 
 import (
+	"database/sql/driver"
+	"encoding/json"
 	"errors"
 	"fmt"
-	"time"
 
-	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
 
 	"github.com/lack-io/cirrus/config"
@@ -16,6 +16,11 @@ var (
 	ErrConnectDB     = errors.New("connect database")
 	ErrDBWrite       = errors.New("write to database")
 	ErrDBRead        = errors.New("read from database")
+	ErrNotFound      = errors.New("record not found")
+	ErrInvalidQuery  = errors.New("invalid query")
+	ErrDeleted       = errors.New("good deleted")
+	// ErrSchemaAhead 数据库的表结构版本比程序支持的版本新
+	ErrSchemaAhead = errors.New("database schema is newer than cirrus")
 )
 
 type Pagination struct {
@@ -30,7 +35,7 @@ type Pagination struct {
 type Good struct {
 	ID uint64 `gorm:"column:id;primaryKey"`
 
-	// UID 唯一ID
+	// UID 唯一ID，每个 UID 只有一条最新状态
 	UID string `json:"uid" gorm:"column:uid"`
 
 	// URL 所在网址
@@ -38,7 +43,7 @@ type Good struct {
 
 	ScaleOut bool `json:"scaleOut" gorm:"column:scaleout"`
 
-	Brandless bool `json:"brandless" gorm:"column:"brandless"`
+	Brandless bool `json:"brandless" gorm:"column:brandless"`
 
 	// Comments 评论数
 	Comments int `json:"comments" gorm:"column:comments"`
@@ -48,101 +53,184 @@ type Good struct {
 
 	// 入库时间
 	Timestamp int64 `json:"timestamp" gorm:"column:timestamp"`
-}
 
-type Store struct {
-	cfg *config.Store
+	// Depth 从任务的起始路径到宝贝页面的深度
+	Depth int `json:"depth" gorm:"column:depth"`
 
-	db *gorm.DB
-}
+	// Parent 发现宝贝页面的页面路径
+	Parent string `json:"parent" gorm:"column:parent"`
 
-func NewStore(cfg *config.Store) (*Store, error) {
-	s := &Store{cfg: cfg}
+	// Provenance 从任务的起始路径到 Parent 的路径链
+	Provenance Chain `json:"provenance" gorm:"column:provenance;type:text"`
 
-	switch cfg.DB {
-	case config.Sqlite:
-		if cfg.Sqlite == nil || cfg.Sqlite.Name == "" {
-			return nil, fmt.Errorf("%w: missing cfg sqlite", ErrInvalidConfig)
-		}
-		var err error
-		s.db, err = gorm.Open(sqlite.Open(cfg.Sqlite.Name), &gorm.Config{})
-		if err != nil {
-			return nil, fmt.Errorf("%w: %v", ErrConnectDB, err)
-		}
-	}
+	// Title 商品名称
+	Title string `json:"title" gorm:"column:title"`
 
-	DB, err := s.db.DB()
-	if err != nil {
-		return nil, fmt.Errorf("%w: %v", ErrConnectDB, err)
-	}
+	// Price 当前价格
+	Price float64 `json:"price" gorm:"column:price"`
 
-	DB.SetConnMaxLifetime(time.Second * 5)
-	DB.SetMaxIdleConns(50)
-	DB.SetMaxOpenConns(10)
+	// Currency 价格的货币，例如 EUR
+	Currency string `json:"currency" gorm:"column:currency"`
 
-	err = s.db.Table("goods").AutoMigrate(&Good{})
-	if err != nil {
-		return nil, fmt.Errorf("%w: %v", ErrDBWrite, err)
-	}
+	// Seller 卖家名称
+	Seller string `json:"seller" gorm:"column:seller"`
 
-	return s, nil
-}
+	// Category 面包屑导航中的分类，以 > 分隔
+	Category string `json:"category" gorm:"column:category"`
 
-func (s *Store) GetGoods(pg *Pagination) ([]*Good, error) {
-	goods := make([]*Good, 0)
+	// Rating 评分
+	Rating float64 `json:"rating" gorm:"column:rating"`
 
-	db := s.db.Table("goods").Order("timestamp desc")
-	if pg != nil {
-		_ = db.Count(&pg.Total)
-		db = db.Limit(pg.Size).Offset((pg.Page - 1) * pg.Size)
-	}
+	// Image 商品主图的地址
+	Image string `json:"image" gorm:"column:image"`
 
-	err := db.Find(&goods).Error
-	if err != nil {
-		return nil, fmt.Errorf("%w: %v", ErrDBRead, err)
-	}
+	// EAN 商品的 EAN/GTIN 编码
+	EAN string `json:"ean" gorm:"column:ean"`
 
-	return goods, nil
+	// FirstSeen 第一次爬取到宝贝的时间
+	FirstSeen int64 `json:"firstSeen" gorm:"column:first_seen"`
+
+	// LastSeen 最近一次爬取到宝贝的时间
+	LastSeen int64 `json:"lastSeen" gorm:"column:last_seen"`
+
+	// Latest 是否为宝贝的最新状态，升级前重复保存的旧记录为 false
+	Latest bool `json:"latest" gorm:"column:latest;default:false"`
+
+	// State 审核状态，再次爬取到宝贝时不会修改审核信息
+	State State `json:"state" gorm:"column:state;default:new"`
+
+	// Notes 审核备注
+	Notes string `json:"notes" gorm:"column:notes"`
+
+	// Tags 审核标签
+	Tags Tags `json:"tags" gorm:"column:tags;type:text"`
+
+	// Reviewer 最后一次修改审核信息的人
+	Reviewer string `json:"reviewer" gorm:"column:reviewer"`
+
+	// ReviewedAt 最后一次修改审核信息的时间
+	ReviewedAt int64 `json:"reviewedAt" gorm:"column:reviewed_at"`
+
+	// DeletedAt 删除的时间，没有被删除时为 0
+	DeletedAt int64 `json:"deletedAt" gorm:"column:deleted_at;default:0"`
 }
 
-func (s *Store) GetGoodsByTimeout(start, end int64, pg *Pagination) ([]*Good, error) {
-	goods := make([]*Good, 0)
+// Observation 一次爬取到的宝贝状态，用于查看宝贝的历史变化
+type Observation struct {
+	ID uint64 `json:"-" gorm:"column:id;primaryKey"`
 
-	db := s.db.Table("goods").Order("timestamp desc")
-	if pg != nil {
-		db = db.Limit(pg.Size).Offset((pg.Page - 1) * pg.Size)
-	}
+	// UID 宝贝的唯一ID
+	UID string `json:"uid" gorm:"column:uid"`
 
-	db = db.Where("timestamp > ? AND timestamp < ?", start, end)
-	if pg != nil {
-		_ = db.Count(&pg.Total)
-		db = db.Limit(pg.Size).Offset((pg.Page - 1) * pg.Size)
-	}
+	// Comments 评论数
+	Comments int `json:"comments" gorm:"column:comments"`
 
-	err := db.Find(&goods).Error
-	if err != nil {
-		return nil, fmt.Errorf("%w: %v", ErrDBRead, err)
-	}
+	// ScaleOut 是否缺货
+	ScaleOut bool `json:"scaleOut" gorm:"column:scaleout"`
+
+	// Shipping 发货渠道信息
+	Shipping string `json:"shipping" gorm:"column:shipping"`
 
-	return goods, nil
+	// Price 价格，页面中没有价格时为 0
+	Price float64 `json:"price" gorm:"column:price"`
+
+	// Timestamp 爬取时间
+	Timestamp int64 `json:"timestamp" gorm:"column:timestamp"`
 }
 
-func (s *Store) AddGood(good *Good) error {
-	err := s.db.Table("goods").Create(good).Error
+// Chain 路径链，以 JSON 数组的格式保存到数据库
+type Chain []string
+
+func (c Chain) Value() (driver.Value, error) {
+	if c == nil {
+		return "[]", nil
+	}
+	data, err := json.Marshal(c)
 	if err != nil {
-		return fmt.Errorf("%w: %v", ErrDBWrite, err)
+		return nil, err
 	}
-
-	return nil
+	return string(data), nil
 }
 
-func (s *Store) DelGroup(id int64) (*Good, error) {
-	good := &Good{}
-	err := s.db.Table("goods").Delete(good, "id = ?", id).Error
-	return good, err
+func (c *Chain) Scan(v interface{}) error {
+	var data []byte
+	switch t := v.(type) {
+	case nil:
+		*c = nil
+		return nil
+	case []byte:
+		data = t
+	case string:
+		data = []byte(t)
+	default:
+		return fmt.Errorf("unsupported chain type %T", v)
+	}
+	if len(data) == 0 {
+		*c = nil
+		return nil
+	}
+	return json.Unmarshal(data, c)
 }
 
-func (s *Store) Reset() {
+// Store 宝贝信息的存储
+type Store interface {
+	// GetGoods 按照入库时间倒序返回满足 f 的宝贝，pg 不为 nil 时分页并返回总数
+	GetGoods(f *Filter, pg *Pagination) ([]*Good, error)
+	// GetGoodsByTimeout 按照入库时间倒序返回满足 f 并且入库时间在 (start, end) 之间的宝贝
+	GetGoodsByTimeout(start, end int64, f *Filter, pg *Pagination) ([]*Good, error)
+	// SearchGoods 在宝贝的名称、品牌、分类和网址中全文搜索 q，按照相关度倒序返回满足 f 的宝贝，
+	// q 中的多个词需要同时命中，q 为空时返回 ErrInvalidQuery
+	SearchGoods(q string, f *Filter, pg *Pagination) ([]*Hit, error)
+	// WalkGoods 按照 GetGoods 或者 SearchGoods (q 不为空时) 的顺序逐个读取满足 f 的宝贝，不会将所有的宝贝读取到内存中，
+	// fn 返回错误时停止读取并返回该错误
+	WalkGoods(q string, f *Filter, fn func(good *Good) error) error
+	// GetGoodByUID 返回 UID 为 uid 的宝贝的最新状态，不存在时返回 ErrNotFound
+	GetGoodByUID(uid string) (*Good, error)
+	// AddGood 保存宝贝，UID 已经存在时更新宝贝的最新状态，UID 已经被删除时返回 ErrDeleted
+	AddGood(good *Good) error
+	// AddObservation 保存一次爬取到的宝贝状态
+	AddObservation(o *Observation) error
+	// GetObservations 按照爬取时间顺序返回 UID 为 uid 的宝贝在 [start, end] 之间的状态，end 为 0 时不限制
+	GetObservations(uid string, start, end int64) ([]*Observation, error)
+	// UpdateGood 修改 ID 为 id 的宝贝的审核信息，返回修改后的宝贝，不存在时返回 ErrNotFound
+	UpdateGood(id int64, patch *Patch) (*Good, error)
+	// SetGoodsState 将满足 f 的宝贝的审核状态修改为 state，返回修改的宝贝个数
+	SetGoodsState(f *Filter, state State, reviewer string) (int64, error)
+	// DelGroup 删除 ID 为 id 的宝贝，返回删除的宝贝，不存在或者已经删除时返回 ErrNotFound
+	DelGroup(id int64) (*Good, error)
+	// DeleteGoods 删除满足 f 的宝贝，返回删除的 UID 个数。删除的宝贝放入回收站，
+	// 并以 UID 记录墓碑，AddGood 不会再次保存这些宝贝
+	DeleteGoods(f *Filter) (int64, error)
+	// RestoreGoods 恢复回收站中满足 f 的宝贝并删除墓碑，返回恢复的 UID 个数
+	RestoreGoods(f *Filter) (int64, error)
+	Reset()
+}
 
+// NewStore 根据 cfg.DB 创建 Store
+func NewStore(cfg *config.Store) (Store, error) {
+	dialector, err := dialector(cfg)
+	if err != nil {
+		return nil, err
+	}
+	db, err := open(dialector)
+	if err != nil {
+		return nil, err
+	}
+	return db, nil
 }
 
+// dialector 根据 cfg.DB 返回数据库的 gorm.Dialector
+func dialector(cfg *config.Store) (gorm.Dialector, error) {
+	if cfg == nil {
+		return nil, fmt.Errorf("%w: missing cfg store", ErrInvalidConfig)
+	}
+
+	switch cfg.DB {
+	case config.Sqlite, "":
+		return sqliteDialector(cfg.Sqlite)
+	case config.Postgres:
+		return postgresDialector(cfg.Postgres)
+	default:
+		return nil, fmt.Errorf("%w: unknown db %q", ErrInvalidConfig, cfg.DB)
+	}
+}
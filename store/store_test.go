@@ -0,0 +1,431 @@
+package store
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"github.com/lack-io/cirrus/config"
+)
+
+func TestNewStore(t *testing.T) {
+	_, err := NewStore(&config.Store{DB: "mysql"})
+	assert.True(t, errors.Is(err, ErrInvalidConfig))
+
+	_, err = NewStore(&config.Store{DB: config.Sqlite})
+	assert.True(t, errors.Is(err, ErrInvalidConfig))
+
+	_, err = NewStore(&config.Store{DB: config.Postgres})
+	assert.True(t, errors.Is(err, ErrInvalidConfig))
+
+	// 未配置 db 时默认使用 sqlite
+	s, err := NewStore(&config.Store{Sqlite: &config.DBSqlite{Name: filepath.Join(t.TempDir(), "cirrus.db")}})
+	if assert.NoError(t, err) {
+		assert.IsType(t, &DB{}, s)
+	}
+}
+
+func TestSqlite(t *testing.T) {
+	s, err := NewSqlite(&config.DBSqlite{Name: filepath.Join(t.TempDir(), "cirrus.db")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 使用 sqlite_fts5 标签编译时使用 FTS5
+	var fts5 bool
+	if err = s.db.Raw("SELECT sqlite_compileoption_used('ENABLE_FTS5')").Row().Scan(&fts5); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, !fts5, s.FTS4())
+
+	testStore(t, s)
+	testObservations(t, s)
+	testSearch(t, s)
+	testFilter(t, s)
+	testCuration(t, s)
+	testTrash(t, s)
+}
+
+// TestPostgres 需要设置 CIRRUS_TEST_POSTGRES 为 PostgreSQL 的连接字符串，测试会清空 goods、observations 和 tombstones 表
+func TestPostgres(t *testing.T) {
+	dsn := os.Getenv("CIRRUS_TEST_POSTGRES")
+	if dsn == "" {
+		t.Skip("CIRRUS_TEST_POSTGRES is not set")
+	}
+
+	s, err := NewPostgres(&config.DBPostgres{DSN: dsn})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// schema_migrations 记录的是表结构，不需要清空
+	for _, table := range []string{"goods", "observations", "tombstones"} {
+		if err = s.db.Exec("DELETE FROM " + table).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	testStore(t, s)
+	testObservations(t, s)
+	testSearch(t, s)
+	testFilter(t, s)
+	testCuration(t, s)
+	testTrash(t, s)
+}
+
+func testStore(t *testing.T, s Store) {
+	goods := []*Good{
+		{UID: "a", URL: "https://www.cdiscount.com/f-1-a.html", Timestamp: 100, Provenance: Chain{"https://www.cdiscount.com"}},
+		{UID: "b", URL: "https://www.cdiscount.com/f-1-b.html", Timestamp: 200},
+		{UID: "a", URL: "https://www.cdiscount.com/f-1-a.html", Timestamp: 300, Comments: 5, Title: "Souris", Price: 14.99, Currency: "EUR"},
+	}
+	for _, good := range goods {
+		assert.NoError(t, s.AddGood(good))
+		assert.NotZero(t, good.ID)
+	}
+
+	// 再次保存的宝贝更新原来的记录
+	assert.Equal(t, goods[0].ID, goods[2].ID)
+	assert.Equal(t, int64(100), goods[2].FirstSeen)
+
+	pg := &Pagination{Page: 1, Size: 1}
+	list, err := s.GetGoods(&Filter{Latest: true}, pg)
+	if assert.NoError(t, err) && assert.Len(t, list, 1) {
+		assert.Equal(t, int64(2), pg.Total)
+		assert.Equal(t, "a", list[0].UID)
+		assert.Equal(t, 5, list[0].Comments)
+		assert.Equal(t, "Souris", list[0].Title)
+		assert.Equal(t, 14.99, list[0].Price)
+		assert.Equal(t, "EUR", list[0].Currency)
+		assert.Equal(t, int64(100), list[0].FirstSeen)
+		assert.Equal(t, int64(300), list[0].LastSeen)
+		assert.True(t, list[0].Latest)
+	}
+
+	list, err = s.GetGoodsByTimeout(150, 250, nil, nil)
+	if assert.NoError(t, err) && assert.Len(t, list, 1) {
+		assert.Equal(t, "b", list[0].UID)
+	}
+
+	good, err := s.GetGoodByUID("a")
+	if assert.NoError(t, err) {
+		assert.Equal(t, 5, good.Comments)
+	}
+	_, err = s.GetGoodByUID("c")
+	assert.True(t, errors.Is(err, ErrNotFound))
+
+	_, err = s.DelGroup(int64(goods[1].ID))
+	assert.NoError(t, err)
+	list, err = s.GetGoods(nil, nil)
+	if assert.NoError(t, err) {
+		assert.Len(t, list, 1)
+	}
+}
+
+func testObservations(t *testing.T, s Store) {
+	for i, price := range []float64{19.99, 17.5, 21} {
+		assert.NoError(t, s.AddObservation(&Observation{UID: "a", Comments: i, Price: price, Timestamp: int64(300 - i*100)}))
+	}
+	assert.NoError(t, s.AddObservation(&Observation{UID: "b", Timestamp: 100}))
+
+	list, err := s.GetObservations("a", 0, 0)
+	if assert.NoError(t, err) && assert.Len(t, list, 3) {
+		assert.Equal(t, int64(100), list[0].Timestamp)
+		assert.Equal(t, 21.0, list[0].Price)
+		assert.Equal(t, 2, list[0].Comments)
+		assert.Equal(t, int64(300), list[2].Timestamp)
+	}
+
+	list, err = s.GetObservations("a", 150, 250)
+	if assert.NoError(t, err) && assert.Len(t, list, 1) {
+		assert.Equal(t, 17.5, list[0].Price)
+	}
+
+	list, err = s.GetObservations("c", 0, 0)
+	if assert.NoError(t, err) {
+		assert.Len(t, list, 0)
+	}
+}
+
+func testSearch(t *testing.T, s Store) {
+	goods := []*Good{
+		{UID: "k1", URL: "https://www.cdiscount.com/f-1-clavier.html", Title: "Clavier <sans fil> Logitech", Express: "Logitech", Category: "Informatique > Clavier", Timestamp: 100},
+		{UID: "k2", URL: "https://www.cdiscount.com/f-1-k2.html", Title: "Tapis de souris", Express: "Logitech", Category: "Informatique > Accessoires", Timestamp: 200},
+		{UID: "k3", URL: "https://www.cdiscount.com/f-1-k3.html", Title: "Casque audio", Express: "Sony", Category: "Son", Timestamp: 300},
+	}
+	for _, good := range goods {
+		assert.NoError(t, s.AddGood(good))
+	}
+
+	_, err := s.SearchGoods("  ", nil, nil)
+	assert.True(t, errors.Is(err, ErrInvalidQuery))
+
+	// 名称中命中的宝贝排在前面
+	pg := &Pagination{Page: 1, Size: 10}
+	hits, err := s.SearchGoods("logitech", &Filter{Latest: true}, pg)
+	if assert.NoError(t, err) && assert.Len(t, hits, 2) {
+		assert.Equal(t, int64(2), pg.Total)
+		assert.Equal(t, "k1", hits[0].UID)
+		assert.True(t, hits[0].Score > hits[1].Score)
+		assert.Equal(t, "Clavier &lt;sans fil&gt; <mark>Logitech</mark>", hits[0].Highlight["title"])
+		assert.Equal(t, "<mark>Logitech</mark>", hits[1].Highlight["express"])
+		assert.NotContains(t, hits[1].Highlight, "title")
+	}
+
+	// 多个词需要同时命中，查询语法按照普通的词处理
+	hits, err = s.SearchGoods(`Clavier "informatique" OR`, nil, nil)
+	if assert.NoError(t, err) {
+		assert.Len(t, hits, 0)
+	}
+	hits, err = s.SearchGoods("clavier informatique", nil, nil)
+	if assert.NoError(t, err) && assert.Len(t, hits, 1) {
+		assert.Equal(t, "k1", hits[0].UID)
+	}
+
+	// 全文索引随着宝贝的更新和删除同步
+	assert.NoError(t, s.AddGood(&Good{UID: "k3", Title: "Casque Logitech", Timestamp: 400}))
+	_, err = s.DelGroup(int64(goods[1].ID))
+	assert.NoError(t, err)
+	hits, err = s.SearchGoods("logitech", nil, nil)
+	if assert.NoError(t, err) && assert.Len(t, hits, 2) {
+		assert.ElementsMatch(t, []string{"k1", "k3"}, []string{hits[0].UID, hits[1].UID})
+	}
+	hits, err = s.SearchGoods("sony", nil, nil)
+	if assert.NoError(t, err) {
+		assert.Len(t, hits, 0)
+	}
+}
+
+func testFilter(t *testing.T, s Store) {
+	goods := []*Good{
+		{UID: "f1", Express: "Apple", Category: "Téléphonie > Smartphone", Comments: 10, Price: 999, Brandless: false, Timestamp: 1000},
+		{UID: "f2", Express: "Apple Store", Category: "Téléphonie > Accessoires", Comments: 3, Price: 19.9, ScaleOut: true, Timestamp: 1100},
+		{UID: "f3", Express: "", Category: "Téléphonie_old", Comments: 0, Price: 5, Brandless: true, Timestamp: 1200},
+		{UID: "f4", Express: "Samsung", Category: "Téléphonie", Comments: 25, Price: 799, Timestamp: 1300},
+	}
+	for _, good := range goods {
+		assert.NoError(t, s.AddGood(good))
+	}
+	uids := func(f *Filter) []string {
+		f.Start = 999
+		list, err := s.GetGoods(f, nil)
+		if !assert.NoError(t, err) {
+			return nil
+		}
+		out := make([]string, 0)
+		for _, good := range list {
+			out = append(out, good.UID)
+		}
+		return out
+	}
+	yes := true
+	three, twenty := 3, 20
+	ten, thousand := 10.0, 1000.0
+
+	assert.Equal(t, []string{"f4", "f3", "f2", "f1"}, uids(&Filter{}))
+	assert.Equal(t, []string{"f3", "f2", "f1"}, uids(&Filter{End: 1300}))
+	assert.Equal(t, []string{"f3"}, uids(&Filter{Brandless: &yes}))
+	assert.Equal(t, []string{"f2"}, uids(&Filter{ScaleOut: &yes}))
+	assert.Equal(t, []string{"f2", "f1"}, uids(&Filter{MinComments: &three, MaxComments: &twenty}))
+	assert.Equal(t, []string{"f1"}, uids(&Filter{Express: "Apple"}))
+	assert.Equal(t, []string{"f2", "f1"}, uids(&Filter{ExpressLike: "aPPle"}))
+	assert.Equal(t, []string{}, uids(&Filter{ExpressLike: "%"}))
+	// 子分类属于分类，名称以分类开头的其他分类不属于分类
+	assert.Equal(t, []string{"f4", "f2", "f1"}, uids(&Filter{Category: "Téléphonie"}))
+	assert.Equal(t, []string{"f4", "f2", "f1"}, uids(&Filter{MinPrice: &ten, MaxPrice: &thousand}))
+
+	assert.Equal(t, []string{"f3", "f2", "f4", "f1"}, uids(&Filter{Sort: []Sort{{Field: "price"}}}))
+	assert.Equal(t, []string{"f4", "f1", "f2", "f3"}, uids(&Filter{Sort: []Sort{{Field: "comments", Desc: true}}}))
+
+	_, err := s.GetGoods(&Filter{Sort: []Sort{{Field: "uid; DROP TABLE goods"}}}, nil)
+	assert.True(t, errors.Is(err, ErrInvalidQuery))
+}
+
+func testCuration(t *testing.T, s Store) {
+	goods := []*Good{
+		{UID: "c1", Title: "Clavier", Timestamp: 2000},
+		{UID: "c2", Title: "Souris", Timestamp: 2100},
+		{UID: "c3", Title: "Casque", Timestamp: 2200},
+	}
+	for _, good := range goods {
+		assert.NoError(t, s.AddGood(good))
+	}
+	uids := func(f *Filter) []string {
+		f.Start = 1999
+		list, err := s.GetGoods(f, nil)
+		if !assert.NoError(t, err) {
+			return nil
+		}
+		out := make([]string, 0)
+		for _, good := range list {
+			out = append(out, good.UID)
+		}
+		return out
+	}
+
+	// 新保存的宝贝为未审核状态
+	assert.Equal(t, []string{"c3", "c2", "c1"}, uids(&Filter{States: []State{StateNew}}))
+
+	state, notes := StateShortlisted, "prix correct"
+	tags := Tags{" promo ", "b2b", "promo", ""}
+	good, err := s.UpdateGood(int64(goods[0].ID), &Patch{State: &state, Notes: &notes, Tags: &tags, Reviewer: "alice"})
+	if assert.NoError(t, err) {
+		assert.Equal(t, StateShortlisted, good.State)
+		assert.Equal(t, notes, good.Notes)
+		assert.Equal(t, Tags{"b2b", "promo"}, good.Tags)
+		assert.Equal(t, "alice", good.Reviewer)
+		assert.NotZero(t, good.ReviewedAt)
+	}
+
+	invalid := State("deleted")
+	_, err = s.UpdateGood(int64(goods[0].ID), &Patch{State: &invalid})
+	assert.True(t, errors.Is(err, ErrInvalidQuery))
+	_, err = s.UpdateGood(int64(goods[0].ID), &Patch{})
+	assert.True(t, errors.Is(err, ErrInvalidQuery))
+	_, err = s.UpdateGood(1<<40, &Patch{Notes: &notes})
+	assert.True(t, errors.Is(err, ErrNotFound))
+
+	// 再次爬取到宝贝时保留审核信息
+	assert.NoError(t, s.AddGood(&Good{UID: "c1", Title: "Clavier AZERTY", Timestamp: 2300}))
+	found, err := s.GetGoodByUID("c1")
+	if assert.NoError(t, err) {
+		assert.Equal(t, "Clavier AZERTY", found.Title)
+		assert.Equal(t, StateShortlisted, found.State)
+		assert.Equal(t, Tags{"b2b", "promo"}, found.Tags)
+	}
+
+	assert.Equal(t, []string{"c1"}, uids(&Filter{Tag: "promo"}))
+	assert.Equal(t, []string{}, uids(&Filter{Tag: "pro"}))
+	assert.Equal(t, []string{"c1"}, uids(&Filter{Reviewer: "alice"}))
+
+	n, err := s.SetGoodsState(&Filter{IDs: []int64{int64(goods[1].ID), int64(goods[2].ID)}}, StateRejected, "bob")
+	if assert.NoError(t, err) {
+		assert.Equal(t, int64(2), n)
+	}
+	assert.Equal(t, []string{"c3", "c2"}, uids(&Filter{States: []State{StateRejected}}))
+	assert.Equal(t, []string{"c1", "c3", "c2"}, uids(&Filter{States: []State{StateRejected, StateShortlisted}}))
+
+	_, err = s.SetGoodsState(&Filter{IDs: []int64{int64(goods[1].ID)}}, State("deleted"), "bob")
+	assert.True(t, errors.Is(err, ErrInvalidQuery))
+	// 没有查询条件时不会修改所有的宝贝
+	_, err = s.SetGoodsState(&Filter{}, StateListed, "bob")
+	assert.True(t, errors.Is(err, ErrInvalidQuery))
+}
+
+func testTrash(t *testing.T, s Store) {
+	goods := []*Good{
+		{UID: "t1", Express: "Trash", Timestamp: 3000},
+		{UID: "t2", Express: "Trash", Timestamp: 3100},
+		{UID: "t3", Express: "Keep", Timestamp: 3200},
+	}
+	for _, good := range goods {
+		assert.NoError(t, s.AddGood(good))
+	}
+	uids := func(f *Filter) []string {
+		f.Start = 2999
+		list, err := s.GetGoods(f, nil)
+		if !assert.NoError(t, err) {
+			return nil
+		}
+		out := make([]string, 0)
+		for _, good := range list {
+			out = append(out, good.UID)
+		}
+		return out
+	}
+
+	good, err := s.DelGroup(int64(goods[2].ID))
+	if assert.NoError(t, err) {
+		assert.Equal(t, "t3", good.UID)
+		assert.NotZero(t, good.DeletedAt)
+	}
+	_, err = s.DelGroup(int64(goods[2].ID))
+	assert.True(t, errors.Is(err, ErrNotFound))
+	_, err = s.GetGoodByUID("t3")
+	assert.True(t, errors.Is(err, ErrNotFound))
+
+	n, err := s.DeleteGoods(&Filter{Express: "Trash"})
+	if assert.NoError(t, err) {
+		assert.Equal(t, int64(2), n)
+	}
+	_, err = s.DeleteGoods(&Filter{})
+	assert.True(t, errors.Is(err, ErrInvalidQuery))
+
+	assert.Equal(t, []string{}, uids(&Filter{}))
+	assert.Equal(t, []string{"t3", "t2", "t1"}, uids(&Filter{Deleted: true}))
+
+	// 删除的宝贝不会再次保存
+	assert.True(t, errors.Is(s.AddGood(&Good{UID: "t1", Timestamp: 3300}), ErrDeleted))
+	assert.Equal(t, []string{}, uids(&Filter{}))
+
+	n, err = s.RestoreGoods(&Filter{IDs: []int64{int64(goods[0].ID)}})
+	if assert.NoError(t, err) {
+		assert.Equal(t, int64(1), n)
+	}
+	_, err = s.RestoreGoods(&Filter{})
+	assert.True(t, errors.Is(err, ErrInvalidQuery))
+	assert.Equal(t, []string{"t1"}, uids(&Filter{}))
+	assert.Equal(t, []string{"t3", "t2"}, uids(&Filter{Deleted: true}))
+
+	assert.NoError(t, s.AddGood(&Good{UID: "t1", Express: "Trash", Timestamp: 3300}))
+	found, err := s.GetGoodByUID("t1")
+	if assert.NoError(t, err) {
+		assert.Equal(t, int64(3300), found.LastSeen)
+		assert.Zero(t, found.DeletedAt)
+	}
+}
+
+func TestSqlite_Upgrade(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "cirrus.db")
+
+	// 升级前的 goods 表中同一个 UID 可能有多条记录
+	db, err := gorm.Open(sqlite.Open(name), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.Exec(`CREATE TABLE goods (id integer PRIMARY KEY AUTOINCREMENT, uid text, url text, scaleout numeric,
+brandless numeric, comments integer, express text, timestamp integer, depth integer, parent text, provenance text)`).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, uid := range []string{"a", "b", "a"} {
+		err = db.Exec("INSERT INTO goods (uid, comments, timestamp) VALUES (?, ?, ?)", uid, i, (i+1)*100).Error
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	sqlDB, _ := db.DB()
+	_ = sqlDB.Close()
+
+	s, err := NewSqlite(&config.DBSqlite{Name: name})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	list, err := s.GetGoods(nil, nil)
+	if assert.NoError(t, err) {
+		assert.Len(t, list, 3)
+	}
+	list, err = s.GetGoods(&Filter{Latest: true}, nil)
+	if assert.NoError(t, err) && assert.Len(t, list, 2) {
+		assert.Equal(t, "a", list[0].UID)
+		assert.Equal(t, 2, list[0].Comments)
+		assert.Equal(t, int64(100), list[0].FirstSeen)
+		assert.Equal(t, int64(300), list[0].LastSeen)
+		assert.Equal(t, StateNew, list[0].State)
+	}
+
+	// 升级后只更新最新状态
+	assert.NoError(t, s.AddGood(&Good{UID: "a", Comments: 9, Timestamp: 400}))
+	list, err = s.GetGoods(nil, nil)
+	if assert.NoError(t, err) {
+		assert.Len(t, list, 3)
+	}
+	good, err := s.GetGoodByUID("a")
+	if assert.NoError(t, err) {
+		assert.Equal(t, 9, good.Comments)
+		assert.Equal(t, int64(100), good.FirstSeen)
+	}
+}
@@ -0,0 +1,84 @@
+package store
+
+import (
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Tombstone 被删除的宝贝的 UID，恢复前爬虫不会再次保存这些宝贝
+type Tombstone struct {
+	UID string `json:"uid" gorm:"column:uid;primaryKey"`
+
+	// DeletedAt 删除的时间
+	DeletedAt int64 `json:"deletedAt" gorm:"column:deleted_at"`
+}
+
+func (s *DB) DelGroup(id int64) (*Good, error) {
+	goods := make([]*Good, 0)
+	err := s.db.Table("goods").Where("id = ? AND deleted_at = 0", id).Limit(1).Find(&goods).Error
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrDBRead, err)
+	}
+	if len(goods) == 0 {
+		return nil, fmt.Errorf("%w: %d", ErrNotFound, id)
+	}
+
+	if _, err = s.DeleteGoods(&Filter{IDs: []int64{id}}); err != nil {
+		return nil, err
+	}
+	goods[0].DeletedAt = time.Now().Unix()
+	return goods[0], nil
+}
+
+// DeleteGoods 按照 UID 删除，满足 f 的宝贝的 UID 的所有记录 (包括历史记录) 一起放入回收站
+func (s *DB) DeleteGoods(f *Filter) (int64, error) {
+	if !f.restricted() {
+		return 0, fmt.Errorf("%w: empty filter", ErrInvalidQuery)
+	}
+	live := *f
+	live.Deleted, live.Sort = false, nil
+
+	var n int64
+	now := time.Now().Unix()
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		uids := where(tx.Table("goods").Select("uid"), &live)
+		result := tx.Exec(`INSERT INTO tombstones (uid, deleted_at) SELECT DISTINCT uid, ? FROM goods WHERE uid IN (?)
+ON CONFLICT (uid) DO NOTHING`, now, uids)
+		if result.Error != nil {
+			return result.Error
+		}
+		n = result.RowsAffected
+
+		return tx.Table("goods").Where("deleted_at = 0 AND uid IN (?)", uids).Update("deleted_at", now).Error
+	})
+	if err != nil {
+		return 0, fmt.Errorf("%w: %v", ErrDBWrite, err)
+	}
+	return n, nil
+}
+
+func (s *DB) RestoreGoods(f *Filter) (int64, error) {
+	if !f.restricted() {
+		return 0, fmt.Errorf("%w: empty filter", ErrInvalidQuery)
+	}
+	trash := *f
+	trash.Deleted, trash.Sort = true, nil
+
+	var n int64
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		uids := where(tx.Table("goods").Select("uid"), &trash)
+		result := tx.Exec("DELETE FROM tombstones WHERE uid IN (?)", uids)
+		if result.Error != nil {
+			return result.Error
+		}
+		n = result.RowsAffected
+
+		return tx.Table("goods").Where("deleted_at > 0 AND uid IN (?)", uids).Update("deleted_at", 0).Error
+	})
+	if err != nil {
+		return 0, fmt.Errorf("%w: %v", ErrDBWrite, err)
+	}
+	return n, nil
+}